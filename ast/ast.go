@@ -208,11 +208,14 @@ func (fl *FloatLiteral) Stringify(indent int) string {
 }
 
 type ArrayStatement struct {
-	Token    token.Token
-	Size     Expression  // The size of the array, can be integer or expression
-	Type     *Identifier // The type of the array (e.g., int, float, or bool)
-	Name     *Identifier // The variable name (e.g., x, y, or z)
-	Elements []Expression
+	Token      token.Token
+	Size       Expression   // The size of the array, can be integer or expression
+	Dimensions []Expression // The sizes of the inner dimensions, e.g. [3] in float m[2][3]
+	Type       *Identifier  // The type of the array (e.g., int, float, or bool)
+	Name       *Identifier  // The variable name (e.g., x, y, or z), nil for literals
+	Elements   []Expression
+	Value      Expression // The initializer when it's not a literal, e.g. reverse(a)
+	Dynamic    bool       // Declared without a size (e.g., int x[]), its size may change
 }
 
 func (as *ArrayStatement) statementNode()       {}
@@ -221,6 +224,12 @@ func (as *ArrayStatement) TokenLiteral() string { return as.Token.Literal }
 func (as *ArrayStatement) String() string {
 	var out bytes.Buffer
 
+	// array literals, e.g. the rows of `int m[2][2] = {{1, 2}, {3, 4}};`
+	if as.Name == nil {
+		as.writeElements(&out)
+		return out.String()
+	}
+
 	out.WriteString(as.Type.String() + " ")
 	out.WriteString(as.Name.String())
 	out.WriteString("[")
@@ -230,25 +239,34 @@ func (as *ArrayStatement) String() string {
 	}
 
 	out.WriteString("]")
+	out.WriteString(dimensionsString(as.Dimensions))
 
-	if len(as.Elements) > 0 {
+	if as.Value != nil {
 		out.WriteString(" = ")
-
-		out.WriteString("{")
-		if len(as.Elements) > 0 {
-			for i, value := range as.Elements {
-				out.WriteString(value.String())
-				if i < len(as.Elements)-1 {
-					out.WriteString(", ")
-				}
-			}
-			out.WriteString("}")
-		}
+		out.WriteString(as.Value.String())
+	} else if len(as.Elements) > 0 {
+		out.WriteString(" = ")
+		as.writeElements(&out)
 	}
 
 	out.WriteString(";")
 	return out.String()
 }
+func (as *ArrayStatement) writeElements(out *bytes.Buffer) {
+	out.WriteString("{")
+	for i, value := range as.Elements {
+		// elements of struct arrays have no default value until compiled
+		if value == nil {
+			out.WriteString("nil")
+		} else {
+			out.WriteString(value.String())
+		}
+		if i < len(as.Elements)-1 {
+			out.WriteString(", ")
+		}
+	}
+	out.WriteString("}")
+}
 func (as *ArrayStatement) Stringify(indent int) string {
 	var out strings.Builder
 
@@ -257,15 +275,19 @@ func (as *ArrayStatement) Stringify(indent int) string {
 
 	indent++
 
-	out.WriteString(strings.Repeat("| ", indent))
-	out.WriteString("Expression(Type): Indentifier (")
-	out.WriteString(as.Type.String())
-	out.WriteString(")\n")
+	if as.Type != nil {
+		out.WriteString(strings.Repeat("| ", indent))
+		out.WriteString("Expression(Type): Indentifier (")
+		out.WriteString(as.Type.String())
+		out.WriteString(")\n")
+	}
 
-	out.WriteString(strings.Repeat("| ", indent))
-	out.WriteString("Expression(Name): Identifier (")
-	out.WriteString(as.Name.String())
-	out.WriteString(")\n")
+	if as.Name != nil {
+		out.WriteString(strings.Repeat("| ", indent))
+		out.WriteString("Expression(Name): Identifier (")
+		out.WriteString(as.Name.String())
+		out.WriteString(")\n")
+	}
 
 	out.WriteString(strings.Repeat("| ", indent))
 	out.WriteString(fmt.Sprintf("Expression(Size): %T (", as.Size))
@@ -274,11 +296,32 @@ func (as *ArrayStatement) Stringify(indent int) string {
 	}
 	out.WriteString(")\n")
 
+	for _, dim := range as.Dimensions {
+		out.WriteString(strings.Repeat("| ", indent))
+		out.WriteString(fmt.Sprintf("Expression(Dimension): %T (", dim))
+		if dim != nil {
+			out.WriteString(dim.String())
+		}
+		out.WriteString(")\n")
+	}
+
+	if as.Value != nil {
+		out.WriteString(strings.Repeat("| ", indent))
+		out.WriteString("Expression(Value):\n")
+		out.WriteString(as.Value.Stringify(indent + 1))
+		return out.String()
+	}
+
 	out.WriteString(strings.Repeat("| ", indent))
 	out.WriteString("Expression(Values):\n")
 
 	if len(as.Elements) > 0 {
 		for _, value := range as.Elements {
+			if value == nil {
+				out.WriteString(strings.Repeat("| ", indent+1))
+				out.WriteString("nil\n")
+				continue
+			}
 			out.WriteString(value.Stringify(indent + 1))
 		}
 	} else {
@@ -449,6 +492,40 @@ func (ie *IfExpression) Stringify(indent int) string {
 	return out.String()
 }
 
+type ReturnStatement struct {
+	Token       token.Token // the 'return' token
+	ReturnValue Expression  // can be nil, returning the function result as is
+}
+
+func (rs *ReturnStatement) statementNode()       {}
+func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(rs.TokenLiteral())
+	if rs.ReturnValue != nil {
+		out.WriteString(" ")
+		out.WriteString(rs.ReturnValue.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+func (rs *ReturnStatement) Stringify(indent int) string {
+	var out strings.Builder
+
+	out.WriteString(strings.Repeat("| ", indent))
+	out.WriteString("Statement: ReturnStatement\n")
+
+	if rs.ReturnValue != nil {
+		out.WriteString(strings.Repeat("| ", indent+1))
+		out.WriteString("ReturnValue:\n")
+		out.WriteString(rs.ReturnValue.Stringify(indent + 2))
+	}
+
+	return out.String()
+}
+
 type WhileStatement struct {
 	Token     token.Token // the 'if' token
 	Condition Expression
@@ -542,6 +619,173 @@ func (fs *ForStatement) Stringify(indent int) string {
 	return out.String()
 }
 
+// ForInStatement iterates the elements of an array, the runes of a string or
+// the pairs of a map, e.g. `for (i, x in arr) { ... }`. Key is nil when the loop
+// has a single variable.
+type ForInStatement struct {
+	Token    token.Token // the 'for' token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+func (fs *ForInStatement) Stringify(indent int) string {
+	var out strings.Builder
+
+	out.WriteString(strings.Repeat("| ", indent))
+	out.WriteString("Statement: ForInStatement\n")
+
+	if fs.Key != nil {
+		out.WriteString(strings.Repeat("| ", indent+1))
+		out.WriteString("Key:\n")
+		out.WriteString(fs.Key.Stringify(indent + 2))
+	}
+
+	out.WriteString(strings.Repeat("| ", indent+1))
+	out.WriteString("Value:\n")
+	out.WriteString(fs.Value.Stringify(indent + 2))
+
+	out.WriteString(strings.Repeat("| ", indent+1))
+	out.WriteString("Iterable:\n")
+	out.WriteString(fs.Iterable.Stringify(indent + 2))
+
+	out.WriteString(strings.Repeat("| ", indent+1))
+	out.WriteString("Body:\n")
+	out.WriteString(fs.Body.Stringify(indent + 2))
+
+	return out.String()
+}
+
+type SwitchStatement struct {
+	Token   token.Token // the 'switch' token
+	Value   Expression
+	Cases   []*SwitchCase
+	Default *BlockStatement // can be nil
+}
+
+func (ss *SwitchStatement) statementNode()       {}
+func (ss *SwitchStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SwitchStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("switch (")
+	out.WriteString(ss.Value.String())
+	out.WriteString(") {")
+	for _, sc := range ss.Cases {
+		out.WriteString(sc.String())
+	}
+	if ss.Default != nil {
+		out.WriteString("default: ")
+		out.WriteString(ss.Default.String())
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+func (ss *SwitchStatement) Stringify(indent int) string {
+	var out strings.Builder
+
+	out.WriteString(strings.Repeat("| ", indent))
+	out.WriteString("Statement: SwitchStatement\n")
+
+	out.WriteString(strings.Repeat("| ", indent+1))
+	out.WriteString("Value:\n")
+	out.WriteString(ss.Value.Stringify(indent + 2))
+
+	for _, sc := range ss.Cases {
+		out.WriteString(sc.Stringify(indent + 1))
+	}
+
+	if ss.Default != nil {
+		out.WriteString(strings.Repeat("| ", indent+1))
+		out.WriteString("Default:\n")
+		out.WriteString(ss.Default.Stringify(indent + 2))
+	}
+
+	return out.String()
+}
+
+type SwitchCase struct {
+	Token  token.Token // the 'case' token
+	Values []Expression
+	Body   *BlockStatement
+}
+
+func (sc *SwitchCase) String() string {
+	var out bytes.Buffer
+
+	values := []string{}
+	for _, v := range sc.Values {
+		values = append(values, v.String())
+	}
+
+	out.WriteString("case ")
+	out.WriteString(strings.Join(values, ", "))
+	out.WriteString(": ")
+	out.WriteString(sc.Body.String())
+
+	return out.String()
+}
+func (sc *SwitchCase) Stringify(indent int) string {
+	var out strings.Builder
+
+	out.WriteString(strings.Repeat("| ", indent))
+	out.WriteString("Case:\n")
+
+	out.WriteString(strings.Repeat("| ", indent+1))
+	out.WriteString("Values:\n")
+	for _, v := range sc.Values {
+		out.WriteString(v.Stringify(indent + 2))
+	}
+
+	out.WriteString(strings.Repeat("| ", indent+1))
+	out.WriteString("Body:\n")
+	out.WriteString(sc.Body.Stringify(indent + 2))
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return bs.TokenLiteral() + ";" }
+func (bs *BreakStatement) Stringify(indent int) string {
+	return strings.Repeat("| ", indent) + "Statement: BreakStatement\n"
+}
+
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return cs.TokenLiteral() + ";" }
+func (cs *ContinueStatement) Stringify(indent int) string {
+	return strings.Repeat("| ", indent) + "Statement: ContinueStatement\n"
+}
+
 type Attribute struct {
 	Token   token.Token
 	Name    *Identifier
@@ -602,10 +846,11 @@ func (a *Attribute) Stringify(indent int) string {
 }
 
 type ReturnType struct {
-	Token   token.Token
-	Type    *Identifier // Type of the parameter
-	IsArray bool
-	Size    Expression
+	Token      token.Token
+	Type       *Identifier // Type of the parameter
+	IsArray    bool
+	Size       Expression
+	Dimensions []Expression // The sizes of the inner dimensions, e.g. [nil] in float[][]
 }
 
 func (rt *ReturnType) expressionNode()      {}
@@ -620,6 +865,7 @@ func (rt *ReturnType) String() string {
 			out.WriteString(rt.Size.String())
 		}
 		out.WriteString("]")
+		out.WriteString(dimensionsString(rt.Dimensions))
 	}
 
 	return out.String()
@@ -648,11 +894,12 @@ func (rt *ReturnType) Stringify(indent int) string {
 }
 
 type Parameter struct {
-	Token   token.Token
-	Name    *Identifier
-	Type    *Identifier // Type of the parameter
-	IsArray bool
-	Size    Expression // Can be nil if the size is not specified
+	Token      token.Token
+	Name       *Identifier
+	Type       *Identifier // Type of the parameter
+	IsArray    bool
+	Size       Expression   // Can be nil if the size is not specified
+	Dimensions []Expression // The sizes of the inner dimensions, e.g. [nil] in float m[][]
 }
 
 func (p *Parameter) expressionNode()      {}
@@ -669,6 +916,7 @@ func (p *Parameter) String() string {
 			out.WriteString(p.Size.String())
 		}
 		out.WriteString("]")
+		out.WriteString(dimensionsString(p.Dimensions))
 	}
 
 	return out.String()
@@ -1049,6 +1297,59 @@ func (ie *IndexExpression) Stringify(indent int) string {
 	return out.String()
 }
 
+// SliceExpression takes the part of a string or an array between Low
+// (included) and High (excluded), e.g. `s[1:3]`. A missing bound is nil.
+type SliceExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Low   Expression
+	High  Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+func (se *SliceExpression) Stringify(indent int) string {
+	var out bytes.Buffer
+
+	out.WriteString(strings.Repeat("| ", indent))
+	out.WriteString("Expression: SliceExpression\n")
+
+	out.WriteString(strings.Repeat("| ", indent+1))
+	out.WriteString("Expression(Left):\n")
+	out.WriteString(se.Left.Stringify(indent + 2))
+
+	if se.Low != nil {
+		out.WriteString(strings.Repeat("| ", indent+1))
+		out.WriteString("Expression(Low):\n")
+		out.WriteString(se.Low.Stringify(indent + 2))
+	}
+
+	if se.High != nil {
+		out.WriteString(strings.Repeat("| ", indent+1))
+		out.WriteString("Expression(High):\n")
+		out.WriteString(se.High.Stringify(indent + 2))
+	}
+
+	return out.String()
+}
+
 type AccessorExpression struct {
 	Token token.Token
 	Left  Expression   // The object being accessed
@@ -1091,6 +1392,87 @@ func (ae *AccessorExpression) Stringify(indent int) string {
 	return out.String()
 }
 
+type StructLiteral struct {
+	Token  token.Token // the name of the struct
+	Name   *Identifier
+	Fields []*Identifier
+	Values []Expression
+}
+
+func (sl *StructLiteral) expressionNode()      {}
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StructLiteral) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for i, f := range sl.Fields {
+		fields = append(fields, f.String()+" = "+sl.Values[i].String())
+	}
+
+	out.WriteString(sl.Name.String())
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+func (sl *StructLiteral) Stringify(indent int) string {
+	var out bytes.Buffer
+
+	out.WriteString(strings.Repeat("| ", indent))
+	out.WriteString("Expression: StructLiteral\n")
+	out.WriteString(strings.Repeat("| ", indent+1))
+	out.WriteString("Name: " + sl.Name.Value + "\n")
+
+	for i, f := range sl.Fields {
+		out.WriteString(strings.Repeat("| ", indent+1))
+		out.WriteString("Field: " + f.Value + "\n")
+		out.WriteString(sl.Values[i].Stringify(indent + 2))
+	}
+
+	return out.String()
+}
+
+type MapLiteral struct {
+	Token  token.Token // the '{' token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (ml *MapLiteral) expressionNode()      {}
+func (ml *MapLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MapLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for i, key := range ml.Keys {
+		pairs = append(pairs, key.String()+": "+ml.Values[i].String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+func (ml *MapLiteral) Stringify(indent int) string {
+	var out bytes.Buffer
+
+	out.WriteString(strings.Repeat("| ", indent))
+	out.WriteString("Expression: MapLiteral\n")
+
+	for i, key := range ml.Keys {
+		out.WriteString(strings.Repeat("| ", indent+1))
+		out.WriteString("Key:\n")
+		out.WriteString(key.Stringify(indent + 2))
+		out.WriteString(strings.Repeat("| ", indent+1))
+		out.WriteString("Value:\n")
+		out.WriteString(ml.Values[i].Stringify(indent + 2))
+	}
+
+	return out.String()
+}
+
 type AssignmentStatement struct {
 	Token token.Token
 	Left  Expression
@@ -1295,3 +1677,18 @@ func (ms *MinusEqualsStatement) Stringify(indent int) string {
 
 	return out.String()
 }
+
+// dimensionsString prints the inner dimensions of an array type, e.g. "[][3]".
+func dimensionsString(dims []Expression) string {
+	var out strings.Builder
+
+	for _, dim := range dims {
+		out.WriteString("[")
+		if dim != nil {
+			out.WriteString(dim.String())
+		}
+		out.WriteString("]")
+	}
+
+	return out.String()
+}
@@ -37,6 +37,7 @@ const (
 	// Jumps
 	OpJumpNotTruthy
 	OpJump
+	OpJumpTable
 
 	OpNull
 
@@ -47,14 +48,40 @@ const (
 	OpSetLocal
 
 	OpArray
+	OpMap
 	OpStruct
 
 	OpIndex
+	OpSetIndex
+	OpSlice
 	OpCall
 	OpReturnValue
 	OpReturn
 	OpGetBuiltin
 	OpGetAttribute
+	OpSetAttribute
+	OpIter
+	OpIterNext
+
+	// Arithmetic and bitwise operators
+	OpMod
+	OpFloorDiv
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpBitNot
+
+	// Conversions
+	OpToFloat
+
+	// Functions
+	OpCurrentFn
+
+	// Arrays
+	OpFillArray
 )
 
 // These are the definitions of the opcodes that we support.
@@ -74,19 +101,38 @@ var definitions = map[Opcode]*Definition{
 	OpMinus:         {"OpMinus", []int{}},
 	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
 	OpJump:          {"OpJump", []int{2}},
+	OpJumpTable:     {"OpJumpTable", []int{2}}, // index of the *object.JumpTable constant
 	OpNull:          {"OpNull", []int{}},
 	OpGetGlobal:     {"OpGetGlobal", []int{2}},
 	OpSetGlobal:     {"OpSetGlobal", []int{2}},
 	OpGetLocal:      {"OpGetLocal", []int{1}},
 	OpSetLocal:      {"OpSetLocal", []int{1}},
 	OpArray:         {"OpArray", []int{2}},
-	OpStruct:        {"OpStruct", []int{2}},
+	OpMap:           {"OpMap", []int{2}},       // number of keys and values
+	OpStruct:        {"OpStruct", []int{2, 1}}, // index of the *object.StructType constant, number of fields set
 	OpIndex:         {"OpIndex", []int{}},
+	OpSetIndex:      {"OpSetIndex", []int{}},
+	OpSlice:         {"OpSlice", []int{}}, // pops the upper bound, the lower bound and the sliced value
 	OpCall:          {"OpCall", []int{1}},
 	OpReturnValue:   {"OpReturnValue", []int{}},
 	OpReturn:        {"OpReturnValue", []int{}},
-	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},
-	OpGetAttribute:  {"OpGetAttribute", []int{1}},
+	OpGetBuiltin:    {"OpGetBuiltin", []int{2}},   // ID of the builtin in object.Builtins
+	OpGetAttribute:  {"OpGetAttribute", []int{2}}, // index of the field name constant
+	OpSetAttribute:  {"OpSetAttribute", []int{2}},
+	OpIter:          {"OpIter", []int{}},
+	OpIterNext:      {"OpIterNext", []int{2, 1}}, // jump target once exhausted, number of loop variables
+	OpMod:           {"OpMod", []int{}},
+	OpFloorDiv:      {"OpFloorDiv", []int{}},
+	OpPow:           {"OpPow", []int{}},
+	OpBitAnd:        {"OpBitAnd", []int{}},
+	OpBitOr:         {"OpBitOr", []int{}},
+	OpBitXor:        {"OpBitXor", []int{}},
+	OpShiftLeft:     {"OpShiftLeft", []int{}},
+	OpShiftRight:    {"OpShiftRight", []int{}},
+	OpBitNot:        {"OpBitNot", []int{}},
+	OpToFloat:       {"OpToFloat", []int{}},    // converts an int stored where a float is expected
+	OpCurrentFn:     {"OpCurrentFn", []int{}},  // pushes the function being executed
+	OpFillArray:     {"OpFillArray", []int{4}}, // number of copies of the popped element
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -115,6 +161,8 @@ func Make(op Opcode, operands ...int) []byte {
 	for i, o := range operands {
 		width := def.OperandWidths[i]
 		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
 		case 1:
@@ -160,6 +208,8 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return def.Name
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
 	}
 
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
@@ -172,6 +222,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 
 	for i, width := range def.OperandWidths {
 		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
 		case 1:
@@ -185,6 +237,10 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
@@ -13,6 +13,8 @@ func TestMake(t *testing.T) {
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpStruct, []int{65534, 255}, []byte{byte(OpStruct), 255, 254, 255}},
+		{OpFillArray, []int{70000}, []byte{byte(OpFillArray), 0, 1, 17, 112}},
 	}
 
 	for _, tt := range tests {
@@ -38,6 +40,8 @@ func TestReadOperands(t *testing.T) {
 	}{
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
+		{OpStruct, []int{65535, 255}, 3},
+		{OpFillArray, []int{70000}, 4},
 	}
 
 	for _, tt := range tests {
@@ -67,12 +71,14 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpGetLocal, 1),
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
+		Make(OpStruct, 1, 2),
 	}
 
 	expected := `0000 OpAdd
 0001 OpGetLocal 1
 0003 OpConstant 2
 0006 OpConstant 65535
+0009 OpStruct 1 2
 `
 
 	concatted := Instructions{}
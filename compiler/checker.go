@@ -0,0 +1,395 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/odas0r/yail/ast"
+	"github.com/odas0r/yail/object"
+)
+
+// Types are represented by their canonical names, the same ones the parser
+// produces: "int", "float", "bool", "string", "point2D", "int[]" or
+// "func(int, int) bool". An empty type name means the type is unknown, and
+// unknown types are never reported as mismatches.
+
+// typeOf infers the static type of an expression.
+func (c *Compiler) typeOf(node ast.Expression) string {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return "int"
+	case *ast.FloatLiteral:
+		return "float"
+	case *ast.Boolean:
+		return "bool"
+	case *ast.StringLiteral:
+		return "string"
+	case *ast.StructLiteral:
+		return node.Name.Value
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			if _, ok := object.Constants[node.Value]; ok {
+				return "float"
+			}
+			return ""
+		}
+		return symbol.Type
+	case *ast.PrefixExpression:
+		if node.Operator == "!" {
+			return "bool"
+		}
+		return c.typeOf(node.Right)
+	case *ast.InfixExpression:
+		switch node.Operator {
+		case "==", "!=", "<", ">", "<=", ">=", "and", "or":
+			return "bool"
+		}
+
+		left, right := c.typeOf(node.Left), c.typeOf(node.Right)
+		if left == right {
+			return left
+		}
+		return ""
+	case *ast.IndexExpression:
+		left := c.typeOf(node.Left)
+		if _, value, ok := splitMapType(left); ok {
+			return value
+		}
+		if strings.HasSuffix(left, "[]") {
+			return strings.TrimSuffix(left, "[]")
+		}
+		if left == "string" {
+			return "string"
+		}
+		return ""
+	case *ast.SliceExpression:
+		return c.typeOf(node.Left)
+	case *ast.AccessorExpression:
+		typ := c.typeOf(node.Left)
+		for _, index := range node.Index {
+			ident, ok := index.(*ast.Identifier)
+			if !ok {
+				return ""
+			}
+
+			typ, _ = c.fieldType(typ, ident.Value)
+		}
+		return typ
+	case *ast.CallExpression:
+		if builtin, ok := c.builtin(node); ok {
+			return builtin.Return
+		}
+
+		_, ret, ok := splitFunctionType(c.calleeType(node.Function))
+		if !ok {
+			return ""
+		}
+		return ret
+	default:
+		return ""
+	}
+}
+
+// calleeType returns the type of the function being called.
+func (c *Compiler) calleeType(fn ast.Expression) string {
+	if symbol, ok := c.resolveFunction(fn); ok {
+		return symbol.Type
+	}
+	return c.typeOf(fn)
+}
+
+// checkCall validates the types of the arguments of a call against the
+// parameters of the function being called, when its signature is known. The
+// number of arguments given to a function is checked by the VM, the one given
+// to a builtin is checked here.
+func (c *Compiler) checkCall(node *ast.CallExpression) error {
+	err := c.checkResize(node)
+	if err != nil {
+		return err
+	}
+
+	if builtin, ok := c.builtin(node); ok {
+		return c.checkBuiltinCall(builtin, node)
+	}
+
+	params, _, ok := splitFunctionType(c.calleeType(node.Function))
+	if !ok || len(params) != len(node.Arguments) {
+		return nil
+	}
+
+	for i, arg := range node.Arguments {
+		got := c.typeOf(arg)
+		if !assignable(params[i], got) {
+			return fmt.Errorf("type mismatch: argument %d of %s must be %s, got %s",
+				i+1, node.Function.String(), params[i], got)
+		}
+	}
+
+	return nil
+}
+
+// builtin returns the builtin called by node, if any.
+func (c *Compiler) builtin(node *ast.CallExpression) (*object.Builtin, bool) {
+	fn, ok := node.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	symbol, ok := c.symbolTable.Resolve(fn.Value)
+	if !ok || symbol.Scope != BuiltinScope {
+		return nil, false
+	}
+
+	return c.builtins.Get(symbol.Index)
+}
+
+// checkBuiltinCall validates the number of arguments of a call to a builtin,
+// and the types of those known at compile time, e.g. `upper(1)` is rejected.
+func (c *Compiler) checkBuiltinCall(builtin *object.Builtin, node *ast.CallExpression) error {
+	err := builtin.CheckArgCount(len(node.Arguments))
+	if err != nil {
+		return err
+	}
+
+	for i, arg := range node.Arguments {
+		param, got := builtin.Param(i), c.typeOf(arg)
+		if !c.matchesParam(param, got) {
+			return fmt.Errorf("type mismatch: argument %d of %s must be %s, got %s",
+				i+1, builtin.Name, param, got)
+		}
+	}
+
+	return nil
+}
+
+// matchesParam reports whether a value of type typ can be given to a builtin
+// parameter param, written as described in object.Registry.
+func (c *Compiler) matchesParam(param, typ string) bool {
+	if typ == "" {
+		return true
+	}
+
+	for _, alt := range strings.Split(param, "|") {
+		var ok bool
+		switch alt {
+		case "any":
+			ok = true
+		case "number":
+			ok = typ == "int" || typ == "float"
+		case "array":
+			ok = strings.HasSuffix(typ, "[]")
+		case "map":
+			ok = isMapType(typ)
+		case "struct":
+			// the struct types of a host application are not declared in
+			// the program, any type that isn't a builtin one is a struct
+			switch {
+			case typ == "int", typ == "float", typ == "bool", typ == "string":
+			case strings.HasSuffix(typ, "[]"), isMapType(typ), strings.HasPrefix(typ, "func("):
+			default:
+				ok = true
+			}
+		default:
+			if elem := strings.TrimSuffix(alt, "[]"); elem != alt {
+				ok = strings.HasSuffix(typ, "[]") && c.matchesParam(elem, strings.TrimSuffix(typ, "[]"))
+			} else {
+				ok = typ == alt
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resizingBuiltins are the builtins changing the size of the array they are
+// given.
+var resizingBuiltins = map[string]bool{"push": true, "pop": true, "insert": true, "remove": true}
+
+// checkResize rejects calls to builtins resizing an array declared with a
+// fixed size, e.g. `int x[3]; push(x, 4);`.
+func (c *Compiler) checkResize(node *ast.CallExpression) error {
+	fn, ok := node.Function.(*ast.Identifier)
+	if !ok || !resizingBuiltins[fn.Value] || len(node.Arguments) == 0 {
+		return nil
+	}
+
+	if symbol, ok := c.symbolTable.Resolve(fn.Value); !ok || symbol.Scope != BuiltinScope {
+		return nil
+	}
+
+	arr, ok := node.Arguments[0].(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+
+	if symbol, ok := c.symbolTable.Resolve(arr.Value); ok && symbol.Size > 0 {
+		return fmt.Errorf("cannot %s fixed-size array %s of size %d", fn.Value, arr.Value, symbol.Size)
+	}
+
+	return nil
+}
+
+// checkKey validates the type of the key used to index a map, e.g. `m[1]` is
+// rejected when m is a map[string]int.
+func (c *Compiler) checkKey(node *ast.IndexExpression) error {
+	key, _, ok := splitMapType(c.typeOf(node.Left))
+	if !ok {
+		return nil
+	}
+
+	if got := c.typeOf(node.Index); !assignable(key, got) {
+		return fmt.Errorf("type mismatch: keys of %s are %s, got %s", node.Left.String(), key, got)
+	}
+
+	return nil
+}
+
+// checkMapLiteral validates the keys and values of a map literal stored in the
+// variable name of type typ.
+func (c *Compiler) checkMapLiteral(name, typ string, value ast.Expression) error {
+	lit, ok := value.(*ast.MapLiteral)
+	if !ok {
+		return nil
+	}
+
+	key, val, ok := splitMapType(typ)
+	if !ok {
+		if typ == "" {
+			return nil
+		}
+		return fmt.Errorf("type mismatch: %s is declared as %s, got a map", name, typ)
+	}
+
+	for i, k := range lit.Keys {
+		if got := c.typeOf(k); !assignable(key, got) {
+			return fmt.Errorf("type mismatch: keys of %s are %s, got %s", name, key, got)
+		}
+		if got := c.typeOf(lit.Values[i]); !assignable(val, got) {
+			return fmt.Errorf("type mismatch: values of %s are %s, got %s", name, val, got)
+		}
+	}
+
+	return nil
+}
+
+// fieldType returns the type of the field name of a value of type typ. It
+// fails when typ is a struct without such a field, the type is unknown when
+// typ is not a struct.
+func (c *Compiler) fieldType(typ, name string) (string, error) {
+	strct, ok := c.symbolTable.ResolveStruct(typ)
+	if !ok {
+		return "", nil
+	}
+
+	field, ok := strct.Type.Field(name)
+	if !ok {
+		return "", fmt.Errorf("unknown field %s in struct %s", name, typ)
+	}
+
+	return field.Type, nil
+}
+
+// assignable reports whether a value of type got can be stored where a value
+// of type want is expected.
+func assignable(want, got string) bool {
+	if want == "" || got == "" || want == got {
+		return true
+	}
+
+	return want == "float" && got == "int"
+}
+
+// typeName returns the canonical name of a declared type with the given
+// number of array dimensions, e.g. "int[]" for an array of integers and
+// "float[][]" for a matrix.
+func typeName(typ *ast.Identifier, dims int) string {
+	if typ == nil || typ.Value == "<unknown>" {
+		return ""
+	}
+
+	return typ.Value + strings.Repeat("[]", dims)
+}
+
+// dimensions returns the number of dimensions of a declared type, 0 if it is
+// not an array.
+func dimensions(isArray bool, inner []ast.Expression) int {
+	if !isArray {
+		return 0
+	}
+	return 1 + len(inner)
+}
+
+// functionType returns the type of a function statement, e.g. for
+// `add(int x, y) int` it returns "func(int, int) int".
+func functionType(fn *ast.FunctionStatement) string {
+	params := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = typeName(p.Type, dimensions(p.IsArray, p.Dimensions))
+	}
+
+	return "func(" + strings.Join(params, ", ") + ") " +
+		typeName(fn.ReturnType.Type, dimensions(fn.ReturnType.IsArray, fn.ReturnType.Dimensions))
+}
+
+// isMapType reports whether typ is a map type, e.g. "map[string]int".
+func isMapType(typ string) bool {
+	return strings.HasPrefix(typ, "map[")
+}
+
+// splitMapType splits a map type into the types of its keys and values, e.g.
+// "map[string]int[]" is split into "string" and "int[]". ok is false if typ is
+// not a map type.
+func splitMapType(typ string) (key, value string, ok bool) {
+	end := strings.Index(typ, "]")
+	if !isMapType(typ) || end < 0 {
+		return "", "", false
+	}
+
+	return typ[len("map["):end], typ[end+1:], true
+}
+
+// isEmptyLiteral reports whether expr is the empty literal `{}`.
+func isEmptyLiteral(expr ast.Expression) bool {
+	arr, ok := expr.(*ast.ArrayStatement)
+	return ok && arr.Name == nil && len(arr.Elements) == 0
+}
+
+// splitFunctionType splits a function type into the types of its parameters
+// and its return type, e.g. "func(int, float[]) bool" is split into
+// ["int", "float[]"] and "bool". ok is false if typ is not a function type.
+func splitFunctionType(typ string) (params []string, ret string, ok bool) {
+	if !strings.HasPrefix(typ, "func(") {
+		return nil, "", false
+	}
+
+	params = []string{}
+	depth := 0
+	start := len("func(")
+
+	for i := start; i < len(typ); i++ {
+		switch typ[i] {
+		case '(':
+			depth++
+		case ',':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(typ[start:i]))
+				start = i + 1
+			}
+		case ')':
+			if depth > 0 {
+				depth--
+				continue
+			}
+
+			if last := strings.TrimSpace(typ[start:i]); last != "" {
+				params = append(params, last)
+			}
+			return params, strings.TrimSpace(typ[i+1:]), true
+		}
+	}
+
+	return nil, "", false
+}
@@ -2,6 +2,8 @@ package compiler
 
 import (
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/odas0r/yail/ast"
 	"github.com/odas0r/yail/code"
@@ -22,6 +24,18 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	result *Symbol        // result variable of the function, nil in the main scope
+	loops  []*loopContext // enclosing loops, innermost last
+}
+
+// loopContext collects the jumps emitted by the break and continue statements
+// of a loop, their targets are only known once the whole loop is compiled. A
+// switch statement is also a loop context, one that can only be broken out of.
+type loopContext struct {
+	breaks    []int
+	continues []int
+	isSwitch  bool
 }
 
 type Compiler struct {
@@ -32,9 +46,18 @@ type Compiler struct {
 	symbolTable         *SymbolTable
 	scopes              []CompilationScope
 	scopeIndex          int
+
+	// builtins are the builtins the program can call
+	builtins *object.Registry
 }
 
 func New() *Compiler {
+	return NewWithBuiltins(object.Builtins)
+}
+
+// NewWithBuiltins returns a compiler for programs calling the builtins of r,
+// e.g. those of the language and the functions of a host application.
+func NewWithBuiltins(r *object.Registry) *Compiler {
 	mainScope := CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
@@ -43,8 +66,8 @@ func New() *Compiler {
 
 	symbolTable := NewSymbolTable()
 
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
+	for _, b := range r.All() {
+		symbolTable.DefineBuiltin(b.ID, b.Name)
 	}
 
 	return &Compiler{
@@ -55,6 +78,7 @@ func New() *Compiler {
 		symbolTable:         symbolTable,
 		scopes:              []CompilationScope{mainScope},
 		scopeIndex:          0,
+		builtins:            r,
 	}
 }
 
@@ -65,15 +89,29 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return compiler
 }
 
+// SymbolTable returns the symbols defined so far, e.g. the globals of the
+// program once it is compiled.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
+		c.declareFunctions(node.Statements)
+
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
 				return err
 			}
 		}
+
+		// the index of a constant is a 2 bytes operand
+		if len(c.constants) > math.MaxUint16+1 {
+			return fmt.Errorf("too many constants: %d, the maximum is %d",
+				len(c.constants), math.MaxUint16+1)
+		}
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -91,6 +129,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
+			if constant, ok := object.Constants[node.Value]; ok {
+				c.emit(code.OpConstant, c.addConstant(constant))
+				return nil
+			}
 			return fmt.Errorf("undefined variable %s", node.Value)
 		}
 
@@ -128,6 +170,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "//":
+			c.emit(code.OpFloorDiv)
+		case "**":
+			c.emit(code.OpPow)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
 		case ">":
 			c.emit(code.OpGreaterThan)
 		case "==":
@@ -147,6 +205,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpBang)
 		case "-":
 			c.emit(code.OpMinus)
+		case "~":
+			c.emit(code.OpBitNot)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
@@ -159,15 +219,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// emit an OpJumpNotTruthy with a bogus value
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
 
-		err = c.Compile(node.Consequence)
+		err = c.compileBranch(node.Consequence)
 		if err != nil {
 			return err
 		}
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
-
 		// Emit an `OpJump` with a bogus value
 		jumpPos := c.emit(code.OpJump, 9999)
 
@@ -177,37 +233,19 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err = c.Compile(node.Alternative)
+			err = c.compileBranch(node.Alternative)
 			if err != nil {
 				return err
 			}
-
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
 		}
 
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
 
 	case *ast.GlobalStatement:
-		// compile the block statement
-		for _, stmt := range node.Body.Statements {
-			err := c.Compile(stmt)
-			if err != nil {
-				return err
-			}
-
-			switch s := stmt.(type) {
-			case *ast.VariableStatement:
-				symbol := c.symbolTable.Define(s.Name.Value)
-				c.emit(code.OpSetGlobal, symbol.Index)
-			case *ast.ArrayStatement:
-				symbol := c.symbolTable.Define(s.Name.Value)
-				c.emit(code.OpSetGlobal, symbol.Index)
-			default:
-				return fmt.Errorf("global statement must contain only variable statements")
-			}
+		err := c.compileDeclarations(node.Body, "global", false)
+		if err != nil {
+			return err
 		}
 	case *ast.StructsStatement:
 		for _, st := range node.Structs {
@@ -217,77 +255,227 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.Struct:
-		structName := node.Name.Value
+		if _, ok := c.symbolTable.ResolveStruct(node.Name.Value); ok {
+			return fmt.Errorf("struct %s already defined", node.Name.Value)
+		}
+
+		structType := &object.StructType{Name: node.Name.Value}
 
 		for _, attr := range node.Attributes {
-			attrName := attr.Name.Value
-			// compile the attribute value
-			err := c.Compile(attr.Value)
+			if _, ok := structType.Field(attr.Name.Value); ok {
+				return fmt.Errorf("duplicate field %s in struct %s", attr.Name.Value, node.Name.Value)
+			}
+
+			value, err := c.defaultObject(attr.Type.Value, attr.IsArray, attr.Size)
 			if err != nil {
 				return err
 			}
 
-			var obj object.Object
-			switch attr.Value.(type) {
-			case *ast.IntegerLiteral:
-				obj = &object.Integer{Value: 0}
-			case *ast.Boolean:
-				obj = &object.Boolean{Value: false}
-			case *ast.StringLiteral:
-				obj = &object.String{Value: ""}
-			case *ast.ArrayStatement:
-				// based on the array type, we should create an array object with
-				// the correct type
-				arrType := attr.Type.Value
-				switch arrType {
-				case "int":
-					obj = &object.Array{Elements: []object.Object{
-						&object.Integer{Value: 0},
-					}}
-				case "bool":
-					obj = &object.Array{Elements: []object.Object{
-						&object.Boolean{Value: false},
-					}}
-				case "float":
-					obj = &object.Array{Elements: []object.Object{
-						&object.Float{Value: 0.0},
-					}}
-				case "string":
-					obj = &object.Array{Elements: []object.Object{
-						&object.String{Value: ""},
-					}}
-				default:
-					obj = &object.Array{Elements: []object.Object{
-						&object.Null{},
-					}}
-				}
+			structType.Fields = append(structType.Fields, object.StructField{
+				Name:    attr.Name.Value,
+				Type:    typeName(attr.Type, dimensions(attr.IsArray, nil)),
+				Default: value,
+			})
+		}
+
+		// the struct type is a constant, every declaration of a variable of
+		// this type creates a new instance of it
+		c.symbolTable.DefineStruct(structType, c.addConstant(structType))
+	case *ast.StructLiteral:
+		strct, ok := c.symbolTable.ResolveStruct(node.Name.Value)
+		if !ok {
+			return fmt.Errorf("undefined struct %s", node.Name.Value)
+		}
+
+		seen := map[string]bool{}
+		for i, f := range node.Fields {
+			if seen[f.Value] {
+				return fmt.Errorf("duplicate field %s in struct literal", f.Value)
+			}
+			seen[f.Value] = true
+
+			field, ok := strct.Type.Field(f.Value)
+			if !ok {
+				return fmt.Errorf("unknown field %s in struct %s", f.Value, strct.Name)
+			}
+
+			got := c.typeOf(node.Values[i])
+			if !assignable(field.Type, got) {
+				return fmt.Errorf("type mismatch: %s.%s is declared as %s, got %s",
+					strct.Name, f.Value, field.Type, got)
 			}
 
-			c.symbolTable.DefineAttribute(structName, attrName, obj)
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: f.Value}))
+
+			err := c.compileAs(field.Type, node.Values[i])
+			if err != nil {
+				return err
+			}
 		}
 
-		// emit the OpStruct instruction
-		c.emit(code.OpStruct, len(node.Attributes))
+		c.emit(code.OpStruct, strct.Index, len(node.Fields))
+
 	case *ast.AccessorExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
 			return err
 		}
 
-		// TODO: this is not working!
+		typ := c.typeOf(node.Left)
+		for _, index := range node.Index {
+			name := index.(*ast.Identifier).Value
 
-		// attr, ok := node.Index[0].(*ast.Identifier)
-		// if !ok {
-		// 	return fmt.Errorf("accessor expression must contain an identifier")
-		// }
+			typ, err = c.fieldType(typ, name)
+			if err != nil {
+				return err
+			}
 
-		// emit the OpGetAttr instruction
-		c.emit(code.OpGetAttribute, 0)
+			c.emit(code.OpGetAttribute, c.addConstant(&object.String{Value: name}))
+		}
 
 	case *ast.ForStatement:
-		// TODO
+		ident, ok := node.Var.(*ast.Identifier)
+		if !ok {
+			return fmt.Errorf("for loop variable must be an identifier")
+		}
+
+		// the loop variable is defined by the loop when it does not exist yet
+		symbol, ok := c.symbolTable.Resolve(ident.Value)
+		if !ok || symbol.Scope == BuiltinScope {
+			symbol = c.symbolTable.DefineWithType(ident.Value, c.typeOf(node.Start))
+		}
+
+		err := c.Compile(node.Start)
+		if err != nil {
+			return err
+		}
+		c.setSymbol(symbol)
+
+		// a step other than a number literal is evaluated once, before the
+		// loop, and its sign picks the direction at runtime
+		var step *Symbol
+		if !isNumberLiteral(node.Increment) {
+			err = c.Compile(node.Increment)
+			if err != nil {
+				return err
+			}
+
+			name := fmt.Sprintf("#step%d", len(c.scopes[c.scopeIndex].loops))
+			stepSymbol, ok := c.symbolTable.ResolveOwn(name)
+			if !ok {
+				stepSymbol = c.symbolTable.DefineWithType(name, "")
+			}
+			c.setSymbol(stepSymbol)
+			step = &stepSymbol
+		}
+
+		loopStart := len(c.currentInstructions())
+
+		// the end is inclusive, so the loop stops once the variable goes past
+		// it: above it when counting up and below it when counting down
+		if step == nil {
+			err = c.compilePastEnd(symbol, node.End, isNegative(node.Increment))
+			if err != nil {
+				return err
+			}
+		} else {
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: 0}))
+			c.loadSymbol(*step)
+			c.emit(code.OpGreaterThan)
+			jumpUpPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+			err = c.compilePastEnd(symbol, node.End, true)
+			if err != nil {
+				return err
+			}
+			jumpEndPos := c.emit(code.OpJump, 9999)
+
+			c.changeOperand(jumpUpPos, len(c.currentInstructions()))
+			err = c.compilePastEnd(symbol, node.End, false)
+			if err != nil {
+				return err
+			}
+			c.changeOperand(jumpEndPos, len(c.currentInstructions()))
+		}
+		c.emit(code.OpBang)
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		c.enterLoop()
+
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		continuePos := len(c.currentInstructions())
+
+		c.loadSymbol(symbol)
+		if step == nil {
+			err = c.Compile(node.Increment)
+			if err != nil {
+				return err
+			}
+		} else {
+			c.loadSymbol(*step)
+		}
+		c.emit(code.OpAdd)
+		c.setSymbol(symbol)
+		c.emit(code.OpJump, loopStart)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		c.leaveLoop(continuePos, afterLoopPos)
+
+	case *ast.ForInStatement:
+		err := c.compileForIn(node)
+		if err != nil {
+			return err
+		}
+
 	case *ast.WhileStatement:
-		// TODO
+		loopStart := len(c.currentInstructions())
+
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		c.enterLoop()
+
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpJump, loopStart)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		c.leaveLoop(loopStart, afterLoopPos)
+
+	case *ast.BreakStatement:
+		loop := c.currentLoop(false)
+		if loop == nil {
+			return fmt.Errorf("break statement outside of a loop")
+		}
+
+		// Emit an `OpJump` with a bogus value, patched when leaving the loop
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loop := c.currentLoop(true)
+		if loop == nil {
+			return fmt.Errorf("continue statement outside of a loop")
+		}
+
+		loop.continues = append(loop.continues, c.emit(code.OpJump, 9999))
+
+	case *ast.SwitchStatement:
+		return c.compileSwitch(node)
+
 	case *ast.IncrementStatement:
 		// TODO
 	case *ast.DecrementStatement:
@@ -300,76 +488,56 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// TODO
 
 	case *ast.ConstStatement:
-		// compile the block statement
-		for _, stmt := range node.Body.Statements {
-			err := c.Compile(stmt)
-			if err != nil {
-				return err
-			}
+		err := c.compileDeclarations(node.Body, "const", true)
+		if err != nil {
+			return err
+		}
 
-			switch s := stmt.(type) {
-			case *ast.VariableStatement:
-				// check if exists, if so return error
-				_, ok := c.symbolTable.Resolve(s.Name.Value)
-				if ok {
-					return fmt.Errorf("variable %s already defined", s.Name.Value)
-				}
+	case *ast.LocalStatement:
+		err := c.compileDeclarations(node.Body, "local", false)
+		if err != nil {
+			return err
+		}
 
-				symbol := c.symbolTable.Define(s.Name.Value)
-				c.emit(code.OpSetGlobal, symbol.Index)
-			case *ast.ArrayStatement:
-				_, ok := c.symbolTable.Resolve(s.Name.Value)
-				if ok {
-					return fmt.Errorf("variable %s already defined", s.Name.Value)
-				}
-				symbol := c.symbolTable.Define(s.Name.Value)
-				c.emit(code.OpSetGlobal, symbol.Index)
-			default:
-				return fmt.Errorf("const statement must contain only variable statements")
+	case *ast.VariableStatement:
+		// every declaration of a struct variable creates a new instance
+		strct, ok := c.symbolTable.ResolveStruct(node.Type.Value)
+		if ok && node.Value == nil {
+			c.emit(code.OpStruct, strct.Index, 0)
+		} else if isMapType(node.Type.Value) && (node.Value == nil || isEmptyLiteral(node.Value)) {
+			// `map[string]int m;` and `map[string]int m = {};` start empty
+			c.emit(code.OpMap, 0)
+		} else if node.Value == nil {
+			// variables without a default value (e.g. functions) start as null
+			c.emit(code.OpNull)
+		} else {
+			declared, got := typeName(node.Type, 0), c.typeOf(node.Value)
+			if !assignable(declared, got) {
+				return fmt.Errorf("type mismatch: %s is declared as %s, got %s",
+					node.Name.Value, declared, got)
 			}
-		}
 
-	case *ast.LocalStatement:
-		// compile the block statement
-		for _, stmt := range node.Body.Statements {
-			err := c.Compile(stmt)
+			err := c.checkMapLiteral(node.Name.Value, declared, node.Value)
 			if err != nil {
 				return err
 			}
 
-			switch s := stmt.(type) {
-			case *ast.VariableStatement:
-				symbol := c.symbolTable.Define(s.Name.Value)
-				c.emit(code.OpSetLocal, symbol.Index)
-			case *ast.ArrayStatement:
-				symbol := c.symbolTable.Define(s.Name.Value)
-				c.emit(code.OpSetLocal, symbol.Index)
-			default:
-				return fmt.Errorf("local statement must contain only variable statements")
+			err = c.compileAs(declared, node.Value)
+			if err != nil {
+				return err
 			}
 		}
 
-	case *ast.VariableStatement:
-		err := c.Compile(node.Value)
+		symbol := c.symbolTable.DefineWithType(node.Name.Value, typeName(node.Type, 0))
+		c.setSymbol(symbol)
+
+	case *ast.IndexExpression:
+		err := c.checkKey(node)
 		if err != nil {
 			return err
 		}
 
-		// check if varType exists in the symbol table
-		symb, ok := c.symbolTable.ResolveStruct(node.Type.Value)
-		if ok {
-			// we should compile the struct and emit an OpConstant with the
-			// object struct
-			strct := &object.Struct{
-				Attributes: symb.Atributes,
-			}
-
-			// emit the OpConstant
-			c.emit(code.OpConstant, c.addConstant(strct))
-		}
-
-	case *ast.IndexExpression:
-		err := c.Compile(node.Left)
+		err = c.Compile(node.Left)
 		if err != nil {
 			return err
 		}
@@ -380,187 +548,347 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpIndex)
 
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		// a missing bound is left for the VM to fill in
+		for _, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+
+			err = c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpSlice)
+
 	case *ast.FunctionStatement:
+		// the name must be defined before the body is compiled, otherwise a
+		// recursive call would not resolve
+		symbol := c.declareFunction(node)
+
 		c.enterScope()
 
 		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Name.Value)
-		}
-
-		hasReturnValue := false
-		for _, stmt := range node.Body.Statements {
-			switch s := stmt.(type) {
-			case *ast.AssignmentStatement:
-				left, ok := s.Left.(*ast.Identifier)
-				if ok && left.Value == node.Name.Value {
-					// compile the return value
-					err := c.Compile(s.Value)
-					if err != nil {
-						return err
-					}
-
-					// emit a OpReturnValue
-					c.emit(code.OpReturnValue)
-					hasReturnValue = true
-				}
-			default:
-				err := c.Compile(stmt)
-				if err != nil {
-					return err
-				}
-			}
+			c.symbolTable.DefineWithType(p.Name.Value, typeName(p.Type, dimensions(p.IsArray, p.Dimensions)))
 		}
 
-		if !hasReturnValue {
-			// emit a OpReturnValue with the default value (from the type)
-			switch node.ReturnType.Type.Value {
-			case "int":
-				if node.ReturnType.IsArray {
-					err := c.Compile(&ast.ArrayStatement{
-						Elements: []ast.Expression{
-							&ast.IntegerLiteral{Value: 0},
-						},
-					})
-					if err != nil {
-						return err
-					}
-				} else {
-					err := c.Compile(&ast.IntegerLiteral{Value: 0})
-					if err != nil {
-						return err
-					}
-				}
-			case "bool":
-				if node.ReturnType.IsArray {
-					err := c.Compile(&ast.ArrayStatement{
-						Elements: []ast.Expression{
-							&ast.Boolean{Value: false},
-						},
-					})
-					if err != nil {
-						return err
-					}
-				} else {
-					err := c.Compile(&ast.Boolean{Value: false})
-					if err != nil {
-						return err
-					}
-				}
-			case "float":
-				if node.ReturnType.IsArray {
-					err := c.Compile(&ast.ArrayStatement{
-						Elements: []ast.Expression{
-							&ast.FloatLiteral{Value: 0.0},
-						},
-					})
-					if err != nil {
-						return err
-					}
-				} else {
-					err := c.Compile(&ast.FloatLiteral{Value: 0.0})
-					if err != nil {
-						return err
-					}
-				}
-			default:
-				return fmt.Errorf("unknown return type %s", node.ReturnType.Type.Value)
+		// inside the body the function name is the result variable, it starts
+		// with the default value of the return type and is returned once the
+		// end of the body is reached
+		result := c.symbolTable.DefineWithType(node.Name.Value,
+			typeName(node.ReturnType.Type, dimensions(node.ReturnType.IsArray, node.ReturnType.Dimensions)))
+		c.scopes[c.scopeIndex].result = &result
+
+		// an array result starts empty, like a dynamic array
+		if node.ReturnType.IsArray {
+			c.emit(code.OpArray, 0)
+		} else {
+			err := c.compileDefaultValue(node.ReturnType.Type, false)
+			if err != nil {
+				return err
 			}
-			// emit a OpReturnValue
-			c.emit(code.OpReturnValue)
 		}
+		c.emit(code.OpSetLocal, result.Index)
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.replaceLastPopWithReturn()
-		}
-		if !c.lastInstructionIs(code.OpReturnValue) {
-			c.emit(code.OpReturn)
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
 		}
 
+		c.emit(code.OpGetLocal, result.Index)
+		c.emit(code.OpReturnValue)
+
 		numLocals := c.symbolTable.numDefinitions
 		instructions := c.leaveScope()
 
 		compiledFn := &object.CompiledFunction{
+			Name:          node.Name.Value,
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
 		}
 		c.emit(code.OpConstant, c.addConstant(compiledFn))
+		c.setSymbol(symbol)
+
+	case *ast.ReturnStatement:
+		result := c.scopes[c.scopeIndex].result
+		if result == nil {
+			return fmt.Errorf("return statement outside of a function")
+		}
 
-		// define the function name
-		symbol := c.symbolTable.Define(node.Name.Value)
-		c.emit(code.OpSetGlobal, symbol.Index)
+		if node.ReturnValue == nil {
+			c.emit(code.OpGetLocal, result.Index)
+			c.emit(code.OpReturnValue)
+			return nil
+		}
 
-		// pop the function
-		// c.emit(code.OpPop)
+		if got := c.typeOf(node.ReturnValue); !assignable(result.Type, got) {
+			return fmt.Errorf("type mismatch: %s must return %s, got %s", result.Name, result.Type, got)
+		}
 
-	case *ast.CallExpression:
-		err := c.Compile(node.Function)
+		err := c.compileAs(result.Type, node.ReturnValue)
 		if err != nil {
 			return err
 		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.AssignmentStatement:
+		switch left := node.Left.(type) {
+		case *ast.Identifier:
+			symbol, ok := c.symbolTable.Resolve(left.Value)
+			if _, constant := object.Constants[left.Value]; !ok && constant {
+				return fmt.Errorf("cannot assign to constant %s", left.Value)
+			}
+			if !ok {
+				return fmt.Errorf("undefined variable %s", left.Value)
+			}
+
+			if got := c.typeOf(node.Value); !assignable(symbol.Type, got) {
+				return fmt.Errorf("type mismatch: %s is declared as %s, got %s",
+					left.Value, symbol.Type, got)
+			}
 
-		for _, arg := range node.Arguments {
-			err := c.Compile(arg)
+			err := c.checkMapLiteral(left.Value, symbol.Type, node.Value)
 			if err != nil {
 				return err
 			}
-		}
-
-		c.emit(code.OpCall, len(node.Arguments))
 
-	// Types
-	case *ast.ArrayStatement:
-		for _, e := range node.Elements {
-			err := c.Compile(e)
+			err = c.compileAs(symbol.Type, node.Value)
+			if err != nil {
+				return err
+			}
+			c.setSymbol(symbol)
+		case *ast.AccessorExpression:
+			err := c.Compile(left.Left)
 			if err != nil {
 				return err
 			}
-		}
-		c.emit(code.OpArray, len(node.Elements))
-	case *ast.Boolean:
-		if node.Value {
-			c.emit(code.OpTrue)
-		} else {
-			c.emit(code.OpFalse)
-		}
-	case *ast.StringLiteral:
-		string := &object.String{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(string))
-	case *ast.FloatLiteral:
-		float := &object.Float{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(float))
-	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(integer))
-	}
-	return nil
-}
-
-func (c *Compiler) Bytecode() *Bytecode {
-	return &Bytecode{
-		Instructions: c.currentInstructions(),
-		Constants:    c.constants,
-	}
-}
 
-func (c *Compiler) emit(op code.Opcode, operands ...int) int {
-	ins := code.Make(op, operands...)
-	pos := c.addInstruction(ins)
+			// every field but the last one is loaded, the last one is set on
+			// the struct that holds it
+			typ := c.typeOf(left.Left)
+			path := left.Left.String()
+			for i, index := range left.Index {
+				name := index.(*ast.Identifier).Value
+				path += "." + name
 
-	c.setLastInstruction(op, pos)
+				typ, err = c.fieldType(typ, name)
+				if err != nil {
+					return err
+				}
 
-	return pos
-}
+				if i < len(left.Index)-1 {
+					c.emit(code.OpGetAttribute, c.addConstant(&object.String{Value: name}))
+				}
+			}
 
-func (c *Compiler) currentInstructions() code.Instructions {
-	return c.scopes[c.scopeIndex].instructions
-}
+			got := c.typeOf(node.Value)
+			if !assignable(typ, got) {
+				return fmt.Errorf("type mismatch: %s is declared as %s, got %s", path, typ, got)
+			}
 
-func (c *Compiler) addInstruction(ins []byte) int {
-	posNewInstruction := len(c.currentInstructions())
-	updatedInstructions := append(c.currentInstructions(), ins...)
+			err = c.compileAs(typ, node.Value)
+			if err != nil {
+				return err
+			}
 
-	c.scopes[c.scopeIndex].instructions = updatedInstructions
+			last := left.Index[len(left.Index)-1].(*ast.Identifier).Value
+			c.emit(code.OpSetAttribute, c.addConstant(&object.String{Value: last}))
+		case *ast.IndexExpression:
+			err := c.checkKey(left)
+			if err != nil {
+				return err
+			}
+
+			if c.typeOf(left.Left) == "string" {
+				return fmt.Errorf("cannot assign to %s: strings are immutable", left.String())
+			}
+
+			want, got := c.typeOf(left), c.typeOf(node.Value)
+			if !assignable(want, got) {
+				what := "elements"
+				if isMapType(c.typeOf(left.Left)) {
+					what = "values"
+				}
+				return fmt.Errorf("type mismatch: %s of %s are %s, got %s",
+					what, left.Left.String(), want, got)
+			}
+
+			err = c.Compile(left.Left)
+			if err != nil {
+				return err
+			}
+
+			err = c.Compile(left.Index)
+			if err != nil {
+				return err
+			}
+
+			err = c.compileAs(want, node.Value)
+			if err != nil {
+				return err
+			}
+
+			c.emit(code.OpSetIndex)
+		default:
+			return fmt.Errorf("illegal assignment target %s", node.Left.String())
+		}
+
+	case *ast.CallExpression:
+		err := c.checkCall(node)
+		if err != nil {
+			return err
+		}
+
+		if symbol, ok := c.resolveFunction(node.Function); ok {
+			c.loadSymbol(symbol)
+		} else {
+			err = c.Compile(node.Function)
+			if err != nil {
+				return err
+			}
+		}
+
+		params := c.paramTypes(node)
+		for i, arg := range node.Arguments {
+			err := c.compileAs(params[i], arg)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	// Types
+	case *ast.MapLiteral:
+		for i, key := range node.Keys {
+			err := c.Compile(key)
+			if err != nil {
+				return err
+			}
+
+			err = c.Compile(node.Values[i])
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpMap, 2*len(node.Keys))
+	case *ast.ArrayStatement:
+		if node.Value != nil {
+			return c.compileArrayInitializer(node)
+		}
+
+		size, err := c.arraySize(node)
+		if err != nil {
+			return err
+		}
+
+		// an array repeating the same literal, e.g. the default values of
+		// `int a[1000];`, is filled with copies of a single element
+		if e, ok := repeatedElement(node.Elements); ok {
+			if len(node.Elements) > math.MaxUint32 {
+				return fmt.Errorf("array of %d elements is too large, the maximum is %d",
+					len(node.Elements), math.MaxUint32)
+			}
+
+			err := c.compileElement(node, e)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpFillArray, len(node.Elements))
+		} else {
+			if len(node.Elements) > math.MaxUint16 {
+				return fmt.Errorf("array literal of %d elements is too large, the maximum is %d",
+					len(node.Elements), math.MaxUint16)
+			}
+
+			for _, e := range node.Elements {
+				err := c.compileElement(node, e)
+				if err != nil {
+					return err
+				}
+			}
+			c.emit(code.OpArray, len(node.Elements))
+		}
+
+		// a named array is a declaration, or an assignment when its type is
+		// unknown (e.g. `x = {1, 2};`)
+		if node.Name == nil {
+			return nil
+		}
+
+		typ := typeName(node.Type, 1+len(node.Dimensions))
+		if typ == "" {
+			symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+			if !ok {
+				return fmt.Errorf("undefined variable %s", node.Name.Value)
+			}
+			if symbol.Size > 0 && symbol.Size != len(node.Elements) {
+				return fmt.Errorf("array size mismatch: %s has %d elements, got %d",
+					node.Name.Value, symbol.Size, len(node.Elements))
+			}
+			c.setSymbol(symbol)
+			return nil
+		}
+
+		if node.Dynamic {
+			size = 0
+		}
+
+		symbol := c.symbolTable.DefineArray(node.Name.Value, typ, size)
+		c.setSymbol(symbol)
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.StringLiteral:
+		string := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(string))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	}
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+	}
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
 
 	return posNewInstruction
 }
@@ -641,6 +969,766 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
+// enterLoop starts collecting the break and continue statements of a loop.
+func (c *Compiler) enterLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loopContext{})
+}
+
+// enterSwitch starts collecting the break statements of a switch statement.
+func (c *Compiler) enterSwitch() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loopContext{isSwitch: true})
+}
+
+// leaveLoop patches the jumps of the break and continue statements of the
+// innermost loop to the given positions.
+func (c *Compiler) leaveLoop(continuePos, breakPos int) {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range loop.continues {
+		c.changeOperand(pos, continuePos)
+	}
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, breakPos)
+	}
+}
+
+// currentLoop returns the innermost loop of the current scope, or nil outside
+// of a loop. Loops do not cross function boundaries. Switch statements are
+// skipped when skipSwitches is set, since a continue goes to the enclosing
+// loop.
+func (c *Compiler) currentLoop(skipSwitches bool) *loopContext {
+	loops := c.scopes[c.scopeIndex].loops
+
+	for i := len(loops) - 1; i >= 0; i-- {
+		if !skipSwitches || !loops[i].isSwitch {
+			return loops[i]
+		}
+	}
+
+	return nil
+}
+
+// compileSwitch compiles a switch statement. When the value is an integer and
+// all the case values are dense integer constants it jumps straight to the
+// matching case through an OpJumpTable, otherwise it compares the value
+// against each case in order.
+// Cases never fall through to the next one.
+func (c *Compiler) compileSwitch(node *ast.SwitchStatement) error {
+	valueType := c.typeOf(node.Value)
+	for _, sc := range node.Cases {
+		for _, v := range sc.Values {
+			got := c.typeOf(v)
+			if !assignable(valueType, got) && !assignable(got, valueType) {
+				return fmt.Errorf("type mismatch: case %s does not match switch value of type %s",
+					v.String(), valueType)
+			}
+		}
+	}
+
+	values, isInt := switchIntValues(node)
+	if isInt {
+		seen := map[int64]bool{}
+		for _, caseValues := range values {
+			for _, v := range caseValues {
+				if seen[v] {
+					return fmt.Errorf("duplicate case %d in switch statement", v)
+				}
+				seen[v] = true
+			}
+		}
+	}
+
+	var table *object.JumpTable
+	var caseJumps [][]int // jumps to the body of each case
+	var defaultJump int
+
+	if isInt && valueType == "int" && isDense(values) {
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		table = newJumpTable(values)
+		c.emit(code.OpJumpTable, c.addConstant(table))
+	} else {
+		// the value is evaluated once and kept in a hidden variable, named so
+		// that it can't clash with an identifier
+		name := fmt.Sprintf("#switch%d", len(c.scopes[c.scopeIndex].loops))
+		value, ok := c.symbolTable.ResolveOwn(name)
+		if !ok {
+			value = c.symbolTable.DefineWithType(name, valueType)
+		}
+
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.setSymbol(value)
+
+		caseJumps = make([][]int, len(node.Cases))
+		for i, sc := range node.Cases {
+			for _, v := range sc.Values {
+				c.loadSymbol(value)
+				err := c.Compile(v)
+				if err != nil {
+					return err
+				}
+				c.emit(code.OpNotEqual)
+				caseJumps[i] = append(caseJumps[i], c.emit(code.OpJumpNotTruthy, 9999))
+			}
+		}
+
+		defaultJump = c.emit(code.OpJump, 9999)
+	}
+
+	c.enterSwitch()
+
+	endJumps := []int{}
+	for i, sc := range node.Cases {
+		casePos := len(c.currentInstructions())
+		if table != nil {
+			for _, v := range values[i] {
+				table.Targets[v-table.Min] = casePos
+			}
+		} else {
+			for _, pos := range caseJumps[i] {
+				c.changeOperand(pos, casePos)
+			}
+		}
+
+		err := c.Compile(sc.Body)
+		if err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+	}
+
+	defaultPos := len(c.currentInstructions())
+	if node.Default != nil {
+		err := c.Compile(node.Default)
+		if err != nil {
+			return err
+		}
+	}
+
+	afterSwitchPos := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, afterSwitchPos)
+	}
+
+	if table != nil {
+		table.Default = defaultPos
+		for i, target := range table.Targets {
+			if target == -1 {
+				table.Targets[i] = defaultPos
+			}
+		}
+	} else {
+		c.changeOperand(defaultJump, defaultPos)
+	}
+
+	c.leaveLoop(afterSwitchPos, afterSwitchPos)
+	return nil
+}
+
+// compileForIn compiles a for-in loop. The iterator is kept in a hidden
+// variable, each OpIterNext pushes the variables of the next iteration or
+// leaves the loop once the iterator is exhausted.
+func (c *Compiler) compileForIn(node *ast.ForInStatement) error {
+	keyType, valueType := iterationTypes(c.typeOf(node.Iterable), node.Key == nil)
+
+	err := c.Compile(node.Iterable)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	name := fmt.Sprintf("#iter%d", len(c.scopes[c.scopeIndex].loops))
+	iterator, ok := c.symbolTable.ResolveOwn(name)
+	if !ok {
+		iterator = c.symbolTable.DefineWithType(name, "")
+	}
+	c.setSymbol(iterator)
+
+	// the loop variables are defined by the loop when they do not exist yet
+	value := c.loopVariable(node.Value, valueType)
+	numVars := 1
+	var key Symbol
+	if node.Key != nil {
+		key = c.loopVariable(node.Key, keyType)
+		numVars = 2
+	}
+
+	loopStart := len(c.currentInstructions())
+	c.loadSymbol(iterator)
+	iterNextPos := c.emit(code.OpIterNext, 9999, numVars)
+
+	c.setSymbol(value)
+	if node.Key != nil {
+		c.setSymbol(key)
+	}
+
+	c.enterLoop()
+
+	err = c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpJump, loopStart)
+
+	afterLoopPos := len(c.currentInstructions())
+	c.replaceInstruction(iterNextPos, code.Make(code.OpIterNext, afterLoopPos, numVars))
+	c.leaveLoop(loopStart, afterLoopPos)
+
+	return nil
+}
+
+// loopVariable returns the symbol of a loop variable, defining it with the
+// given type when it does not exist yet.
+func (c *Compiler) loopVariable(ident *ast.Identifier, typ string) Symbol {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok || symbol.Scope == BuiltinScope {
+		symbol = c.symbolTable.DefineWithType(ident.Value, typ)
+	}
+	return symbol
+}
+
+// iterationTypes returns the types of the key and the value visited by a
+// for-in loop over a value of type typ. A loop with a single variable visits
+// the keys of a map, and the elements of an array or the runes of a string.
+func iterationTypes(typ string, single bool) (key, value string) {
+	switch {
+	case isMapType(typ):
+		key, value, _ = splitMapType(typ)
+		if single {
+			return "", key
+		}
+		return key, value
+	case strings.HasSuffix(typ, "[]"):
+		return "int", strings.TrimSuffix(typ, "[]")
+	case typ == "string":
+		return "int", "string"
+	default:
+		return "", ""
+	}
+}
+
+// switchIntValues returns the values of each case of a switch statement, ok is
+// false unless they are all integer constants.
+func switchIntValues(node *ast.SwitchStatement) (values [][]int64, ok bool) {
+	values = make([][]int64, len(node.Cases))
+
+	for i, sc := range node.Cases {
+		for _, v := range sc.Values {
+			switch v := v.(type) {
+			case *ast.IntegerLiteral:
+				values[i] = append(values[i], v.Value)
+			case *ast.PrefixExpression:
+				integer, isInt := v.Right.(*ast.IntegerLiteral)
+				if v.Operator != "-" || !isInt {
+					return nil, false
+				}
+				values[i] = append(values[i], -integer.Value)
+			default:
+				return nil, false
+			}
+		}
+	}
+
+	return values, true
+}
+
+// maxJumpTable is the largest number of entries of a jump table, sparser or
+// wider switches comparing the value against each case instead.
+const maxJumpTable = 1 << 16
+
+// isDense reports whether a jump table for the given case values would be at
+// most half empty, and not larger than maxJumpTable.
+func isDense(values [][]int64) bool {
+	count := 0
+	min, max := int64(0), int64(0)
+
+	for _, caseValues := range values {
+		for _, v := range caseValues {
+			if count == 0 || v < min {
+				min = v
+			}
+			if count == 0 || v > max {
+				max = v
+			}
+			count++
+		}
+	}
+
+	if count == 0 {
+		return false
+	}
+
+	// max-min overflows an int64 when the values are far apart, but never a
+	// uint64
+	span := uint64(max) - uint64(min)
+	return span < maxJumpTable && span < 2*uint64(count)
+}
+
+// newJumpTable returns a jump table covering the given case values, its
+// targets are -1 until the cases are compiled. The values must be dense.
+func newJumpTable(values [][]int64) *object.JumpTable {
+	min, max := values[0][0], values[0][0]
+	for _, caseValues := range values {
+		for _, v := range caseValues {
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+	}
+
+	targets := make([]int, uint64(max)-uint64(min)+1)
+	for i := range targets {
+		targets[i] = -1
+	}
+
+	return &object.JumpTable{Min: min, Targets: targets}
+}
+
+// compilePastEnd emits the check of whether the loop variable went past the
+// end of a for loop, below it when down is set and above it otherwise.
+func (c *Compiler) compilePastEnd(symbol Symbol, end ast.Expression, down bool) error {
+	if down {
+		err := c.Compile(end)
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(symbol)
+	} else {
+		c.loadSymbol(symbol)
+		err := c.Compile(end)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpGreaterThan)
+	return nil
+}
+
+// isNumberLiteral reports whether expr is a number literal, possibly negated.
+func isNumberLiteral(expr ast.Expression) bool {
+	if prefix, ok := expr.(*ast.PrefixExpression); ok && prefix.Operator == "-" {
+		expr = prefix.Right
+	}
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		return true
+	}
+	return false
+}
+
+// isNegative reports whether expr is a negative number literal, e.g. the step
+// of `for(i, 10, 1, -1)`.
+func isNegative(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		if expr.Operator != "-" {
+			return false
+		}
+		switch right := expr.Right.(type) {
+		case *ast.IntegerLiteral:
+			return right.Value > 0
+		case *ast.FloatLiteral:
+			return right.Value > 0
+		}
+	case *ast.IntegerLiteral:
+		return expr.Value < 0
+	case *ast.FloatLiteral:
+		return expr.Value < 0
+	}
+	return false
+}
+
+// compileDeclarations compiles the body of a global, local or const block,
+// which may only declare variables. Constants can't shadow another variable.
+func (c *Compiler) compileDeclarations(block *ast.BlockStatement, kind string, isConst bool) error {
+	for _, stmt := range block.Statements {
+		var name string
+
+		switch s := stmt.(type) {
+		case *ast.VariableStatement:
+			name = s.Name.Value
+		case *ast.ArrayStatement:
+			name = s.Name.Value
+		case *ast.BlockStatement:
+			// several variables declared at once, e.g. `int x, y;`
+			err := c.compileDeclarations(s, kind, isConst)
+			if err != nil {
+				return err
+			}
+			continue
+		default:
+			return fmt.Errorf("%s statement must contain only variable statements", kind)
+		}
+
+		if isConst {
+			if _, ok := c.symbolTable.Resolve(name); ok {
+				return fmt.Errorf("variable %s already defined", name)
+			}
+		}
+
+		err := c.Compile(stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileBranch compiles the block of an if expression so that it always
+// leaves a value on the stack: the value of its last expression statement, or
+// null if the block ends with any other statement.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	n := len(block.Statements)
+	if n > 0 {
+		if _, ok := block.Statements[n-1].(*ast.ExpressionStatement); ok && c.lastInstructionIs(code.OpPop) {
+			c.removeLastPop()
+			return nil
+		}
+	}
+
+	c.emit(code.OpNull)
+	return nil
+}
+
+// compileDefaultValue emits the default value of the given type, e.g. 0 for
+// an int and {0} for an int array.
+func (c *Compiler) compileDefaultValue(typ *ast.Identifier, isArray bool) error {
+	var value ast.Expression
+
+	switch typ.Value {
+	case "int":
+		value = &ast.IntegerLiteral{Value: 0}
+	case "bool":
+		value = &ast.Boolean{Value: false}
+	case "float":
+		value = &ast.FloatLiteral{Value: 0.0}
+	case "string":
+		value = &ast.StringLiteral{Value: ""}
+	default:
+		if strct, ok := c.symbolTable.ResolveStruct(typ.Value); ok && !isArray {
+			c.emit(code.OpStruct, strct.Index, 0)
+			return nil
+		}
+
+		if isMapType(typ.Value) && !isArray {
+			c.emit(code.OpMap, 0)
+			return nil
+		}
+
+		// function values have no meaningful default
+		if !strings.HasPrefix(typ.Value, "func(") {
+			return fmt.Errorf("unknown return type %s", typ.Value)
+		}
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	if isArray {
+		value = &ast.ArrayStatement{Elements: []ast.Expression{value}}
+	}
+
+	return c.Compile(value)
+}
+
+// compileElement compiles an element of an array literal.
+func (c *Compiler) compileElement(node *ast.ArrayStatement, e ast.Expression) error {
+	// elements without a default value, e.g. in `point2D ps[10];`
+	if e == nil {
+		return c.compileDefaultValue(node.Type, false)
+	}
+
+	return c.compileAs(typeName(node.Type, len(node.Dimensions)), e)
+}
+
+// repeatedElement returns the element of an array literal whose elements are
+// all the same literal, or all without a default value. Expressions which
+// aren't literals are never repeated, as evaluating them once could change
+// the result.
+func repeatedElement(elements []ast.Expression) (ast.Expression, bool) {
+	if len(elements) < 2 || !isLiteral(elements[0]) {
+		return nil, false
+	}
+
+	first := elements[0]
+	for _, e := range elements[1:] {
+		if (e == nil) != (first == nil) {
+			return nil, false
+		}
+		if e != nil && fmt.Sprintf("%T %s", e, e) != fmt.Sprintf("%T %s", first, first) {
+			return nil, false
+		}
+	}
+
+	return first, true
+}
+
+// isLiteral reports whether expr is a literal, a row of literals, or an element
+// without a default value.
+func isLiteral(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case nil, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.ArrayStatement:
+		if expr.Name != nil || expr.Value != nil {
+			return false
+		}
+		for _, e := range expr.Elements {
+			if !isLiteral(e) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// compileAs compiles an expression whose value is stored where a value of
+// type want is expected. An int is accepted where a float is expected, it is
+// converted so that the value is a float once stored.
+func (c *Compiler) compileAs(want string, expr ast.Expression) error {
+	err := c.Compile(expr)
+	if err != nil {
+		return err
+	}
+
+	if want == "float" && c.typeOf(expr) != "float" {
+		c.emit(code.OpToFloat)
+	}
+	return nil
+}
+
+// paramTypes returns the types of the parameters a call passes its arguments
+// to, "" for the ones that aren't known. Builtins convert their arguments
+// themselves.
+func (c *Compiler) paramTypes(node *ast.CallExpression) []string {
+	types := make([]string, len(node.Arguments))
+	if _, ok := c.builtin(node); ok {
+		return types
+	}
+
+	params, _, ok := splitFunctionType(c.calleeType(node.Function))
+	if ok && len(params) == len(node.Arguments) {
+		copy(types, params)
+	}
+	return types
+}
+
+// compileArrayInitializer compiles the declaration of an array initialized by
+// an expression, e.g. `int b[] = reverse(a);`. Its size is only known at
+// runtime, so the array must be declared without one.
+func (c *Compiler) compileArrayInitializer(node *ast.ArrayStatement) error {
+	if !node.Dynamic {
+		return fmt.Errorf("array %s with a fixed size must be initialized with an array literal",
+			node.Name.Value)
+	}
+
+	typ := typeName(node.Type, 1+len(node.Dimensions))
+	if got := c.typeOf(node.Value); !assignable(typ, got) {
+		return fmt.Errorf("type mismatch: %s is declared as %s, got %s", node.Name.Value, typ, got)
+	}
+
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	symbol := c.symbolTable.DefineArray(node.Name.Value, typ, 0)
+	c.setSymbol(symbol)
+	return nil
+}
+
+// arraySize returns the declared size of an array statement, 0 if it has
+// none. The size must be a positive integer literal matching the number of
+// elements of the initializer, e.g. `int x[3] = {1, 2};` is rejected.
+func (c *Compiler) arraySize(node *ast.ArrayStatement) (int, error) {
+	if node.Size == nil || node.Name == nil {
+		return 0, nil
+	}
+
+	lit, ok := node.Size.(*ast.IntegerLiteral)
+	if !ok {
+		return 0, fmt.Errorf("size of array %s must be an integer literal, got %s",
+			node.Name.Value, node.Size.String())
+	}
+
+	// only an array without a declared size starts empty, `int a[] = {};`
+	if lit.Value < 0 || lit.Value == 0 && !node.Dynamic {
+		return 0, fmt.Errorf("size of array %s must be positive, got %d", node.Name.Value, lit.Value)
+	}
+
+	if int(lit.Value) != len(node.Elements) {
+		return 0, fmt.Errorf("array size mismatch: %s has %d elements, got %d",
+			node.Name.Value, lit.Value, len(node.Elements))
+	}
+
+	err := checkRows(node.Name.Value, node.Elements, node.Dimensions)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(lit.Value), nil
+}
+
+// checkRows checks that the rows of a multi-dimensional array literal have
+// the sizes of its inner dimensions, e.g. `int m[2][2] = {{1, 2}, {3}};` is
+// rejected. Dimensions without a size accept rows of any size.
+func checkRows(name string, rows []ast.Expression, dims []ast.Expression) error {
+	if len(dims) == 0 {
+		return nil
+	}
+
+	var size int64
+	if dims[0] != nil {
+		lit, ok := dims[0].(*ast.IntegerLiteral)
+		if !ok {
+			return fmt.Errorf("size of array %s must be an integer literal, got %s",
+				name, dims[0].String())
+		}
+		if lit.Value <= 0 {
+			return fmt.Errorf("size of array %s must be positive, got %d", name, lit.Value)
+		}
+		size = lit.Value
+	}
+
+	for _, row := range rows {
+		// rows given by any other expression, e.g. a variable, are not checked
+		arr, ok := row.(*ast.ArrayStatement)
+		if !ok {
+			continue
+		}
+
+		if size > 0 && int(size) != len(arr.Elements) {
+			return fmt.Errorf("array size mismatch: rows of %s have %d elements, got %d",
+				name, size, len(arr.Elements))
+		}
+
+		err := checkRows(name, arr.Elements, dims[1:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// defaultObject returns the default value of a struct field, e.g. 0.0 for a
+// float and {0, 0} for `int x[2]`.
+func (c *Compiler) defaultObject(typ string, isArray bool, size ast.Expression) (object.Object, error) {
+	if isArray {
+		n := int64(1)
+		if lit, ok := size.(*ast.IntegerLiteral); ok && lit.Value > 0 {
+			n = lit.Value
+		}
+
+		elements := make([]object.Object, n)
+		for i := range elements {
+			element, err := c.defaultObject(typ, false, nil)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+
+		return &object.Array{Elements: elements}, nil
+	}
+
+	switch typ {
+	case "int":
+		return &object.Integer{Value: 0}, nil
+	case "float":
+		return &object.Float{Value: 0.0}, nil
+	case "bool":
+		return &object.Boolean{Value: false}, nil
+	case "string":
+		return &object.String{Value: ""}, nil
+	default:
+		// struct fields are initialized with a new instance of their struct
+		if strct, ok := c.symbolTable.ResolveStruct(typ); ok {
+			return strct.Type.New(), nil
+		}
+		if isMapType(typ) {
+			return object.NewMap(), nil
+		}
+		return nil, fmt.Errorf("unknown type %s", typ)
+	}
+}
+
+// resolveFunction resolves the function called by a call expression when its
+// name is shadowed by the result variable of the function being compiled, so
+// that calling it inside its own body is a recursive call.
+func (c *Compiler) resolveFunction(fn ast.Expression) (Symbol, bool) {
+	ident, ok := fn.(*ast.Identifier)
+	if !ok {
+		return Symbol{}, false
+	}
+
+	result := c.scopes[c.scopeIndex].result
+	if result == nil || result.Name != ident.Value {
+		return Symbol{}, false
+	}
+
+	// a function declared inside another one is a local of the enclosing
+	// function, out of reach from its own frame, so it calls the function
+	// being executed instead
+	symbol, ok := c.symbolTable.Outer.Resolve(ident.Value)
+	if ok && symbol.Scope == LocalScope {
+		symbol = Symbol{Name: symbol.Name, Scope: FunctionScope, Type: symbol.Type}
+	}
+	return symbol, ok
+}
+
+// declareFunctions defines the names of all the functions in stmts before any
+// of them is compiled, so that a function body can call functions that are
+// only defined further down the file (e.g. mutual recursion).
+func (c *Compiler) declareFunctions(stmts []ast.Statement) {
+	for _, s := range stmts {
+		if fn, ok := s.(*ast.FunctionStatement); ok {
+			c.declareFunction(fn)
+		}
+	}
+}
+
+// declareFunction returns the symbol of the given function, defining it in the
+// current scope if it was not declared yet.
+func (c *Compiler) declareFunction(fn *ast.FunctionStatement) Symbol {
+	symbol, ok := c.symbolTable.ResolveOwn(fn.Name.Value)
+	if ok && symbol.Scope != BuiltinScope {
+		return symbol
+	}
+
+	return c.symbolTable.DefineWithType(fn.Name.Value, functionType(fn))
+}
+
+func (c *Compiler) setSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
@@ -649,5 +1737,7 @@ func (c *Compiler) loadSymbol(s Symbol) {
 		c.emit(code.OpGetLocal, s.Index)
 	case BuiltinScope:
 		c.emit(code.OpGetBuiltin, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentFn)
 	}
 }
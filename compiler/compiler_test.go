@@ -2,6 +2,8 @@ package compiler
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/odas0r/yail/ast"
@@ -84,6 +86,18 @@ func testConstants(
 				return fmt.Errorf("constant %d - testStringObject failed: %s",
 					i, err)
 			}
+		case *object.StructType:
+			err := testStructType(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testStructType failed: %s",
+					i, err)
+			}
+		case *object.JumpTable:
+			err := testJumpTable(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testJumpTable failed: %s",
+					i, err)
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -100,6 +114,57 @@ func testConstants(
 	return nil
 }
 
+func testStructType(expected *object.StructType, actual object.Object) error {
+	result, ok := actual.(*object.StructType)
+	if !ok {
+		return fmt.Errorf("object is not StructType. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Name != expected.Name {
+		return fmt.Errorf("wrong struct name. got=%q, want=%q", result.Name, expected.Name)
+	}
+
+	if len(result.Fields) != len(expected.Fields) {
+		return fmt.Errorf("wrong number of fields. got=%d, want=%d",
+			len(result.Fields), len(expected.Fields))
+	}
+
+	for i, field := range expected.Fields {
+		if result.Fields[i].Name != field.Name || result.Fields[i].Type != field.Type {
+			return fmt.Errorf("wrong field %d. got=%s %s, want=%s %s", i,
+				result.Fields[i].Type, result.Fields[i].Name, field.Type, field.Name)
+		}
+	}
+
+	return nil
+}
+
+func testJumpTable(expected *object.JumpTable, actual object.Object) error {
+	result, ok := actual.(*object.JumpTable)
+	if !ok {
+		return fmt.Errorf("object is not JumpTable. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Min != expected.Min || result.Default != expected.Default {
+		return fmt.Errorf("wrong jump table. got min=%d default=%d, want min=%d default=%d",
+			result.Min, result.Default, expected.Min, expected.Default)
+	}
+
+	if len(result.Targets) != len(expected.Targets) {
+		return fmt.Errorf("wrong number of targets. got=%v, want=%v",
+			result.Targets, expected.Targets)
+	}
+
+	for i, target := range expected.Targets {
+		if result.Targets[i] != target {
+			return fmt.Errorf("wrong targets. got=%v, want=%v",
+				result.Targets, expected.Targets)
+		}
+	}
+
+	return nil
+}
+
 func testIntegerObject(expected int64, actual object.Object) error {
 	result, ok := actual.(*object.Integer)
 	if !ok {
@@ -201,6 +266,39 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "7 % 2 // 1 ** 3",
+			expectedConstants: []interface{}{7, 2, 1, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpPow),
+				code.Make(code.OpFloorDiv),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "~1 & 2 | 3 ^ 4 << 5 >> 6",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpBitAnd),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpBitOr),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpShiftLeft),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpShiftRight),
+				code.Make(code.OpBitXor),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -261,6 +359,237 @@ func TestConditionals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			while (true) { break; continue; }
+			`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0004
+				code.Make(code.OpJump, 13),
+				// 0007
+				code.Make(code.OpJump, 0),
+				// 0010
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input: `
+			int a[] = {1};
+			for (i, x in a) { break; }
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpSetGlobal, 0),
+				// 0009
+				code.Make(code.OpGetGlobal, 0),
+				// 0012
+				code.Make(code.OpIter),
+				// 0013
+				code.Make(code.OpSetGlobal, 1),
+				// 0016
+				code.Make(code.OpGetGlobal, 1),
+				// 0019
+				code.Make(code.OpIterNext, 35, 2),
+				// 0023
+				code.Make(code.OpSetGlobal, 2),
+				// 0026
+				code.Make(code.OpSetGlobal, 3),
+				// 0029
+				code.Make(code.OpJump, 35),
+				// 0032
+				code.Make(code.OpJump, 16),
+			},
+		},
+		{
+			input: `
+			for (i, 1, 3, 1) { continue; break; }
+			`,
+			expectedConstants: []interface{}{1, 3, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpGreaterThan),
+				// 0013
+				code.Make(code.OpBang),
+				// 0014
+				code.Make(code.OpJumpNotTruthy, 36),
+				// 0017
+				code.Make(code.OpJump, 23),
+				// 0020
+				code.Make(code.OpJump, 36),
+				// 0023
+				code.Make(code.OpGetGlobal, 0),
+				// 0026
+				code.Make(code.OpConstant, 2),
+				// 0029
+				code.Make(code.OpAdd),
+				// 0030
+				code.Make(code.OpSetGlobal, 0),
+				// 0033
+				code.Make(code.OpJump, 6),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`break;`, "break statement outside of a loop"},
+		{`if (true) { continue; }`, "continue statement outside of a loop"},
+		{
+			`
+			while (true) {
+				f() int { break; }
+			}
+			`,
+			"break statement outside of a loop",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expectedError {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expectedError, err)
+		}
+	}
+}
+
+func TestSwitchStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			switch (2) { case 1: 10; case 2, 3: 20; default: 30; }
+			`,
+			expectedConstants: []interface{}{
+				2,
+				&object.JumpTable{Min: 1, Targets: []int{6, 13, 13}, Default: 20},
+				10,
+				20,
+				30,
+			},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpJumpTable, 1),
+				// 0006
+				code.Make(code.OpConstant, 2),
+				// 0009
+				code.Make(code.OpPop),
+				// 0010
+				code.Make(code.OpJump, 24),
+				// 0013
+				code.Make(code.OpConstant, 3),
+				// 0016
+				code.Make(code.OpPop),
+				// 0017
+				code.Make(code.OpJump, 24),
+				// 0020
+				code.Make(code.OpConstant, 4),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			switch ("a") { case "a": 10; default: 20; }
+			`,
+			expectedConstants: []interface{}{"a", "a", 10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpNotEqual),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 19),
+				// 0016
+				code.Make(code.OpJump, 26),
+				// 0019
+				code.Make(code.OpConstant, 2),
+				// 0022
+				code.Make(code.OpPop),
+				// 0023
+				code.Make(code.OpJump, 30),
+				// 0026
+				code.Make(code.OpConstant, 3),
+				// 0029
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSwitchErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{
+			`switch (1) { case 1, 2: 10; case 2: 20; }`,
+			"duplicate case 2 in switch statement",
+		},
+		{
+			`switch (1) { case true: 10; }`,
+			"type mismatch: case true does not match switch value of type int",
+		},
+		{
+			`switch (1) { case 1: continue; }`,
+			"continue statement outside of a loop",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expectedError {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expectedError, err)
+		}
+	}
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -484,12 +813,37 @@ func TestGlobalVarStatements(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			// an int stored where a float is expected is converted
+			input: `
+			global {
+				float one = 1;
+				float two = 2.0;
+			}
+		`,
+			expectedConstants: []interface{}{1, 2.0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpToFloat),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
 }
 
 func TestStructStatements(t *testing.T) {
+	circle := &object.StructType{
+		Name: "circle",
+		Fields: []object.StructField{
+			{Name: "center", Type: "int"},
+			{Name: "radius", Type: "int"},
+		},
+	}
+
 	tests := []compilerTestCase{
 		{
 			input: `
@@ -497,11 +851,13 @@ func TestStructStatements(t *testing.T) {
 				point2D {int x;};
 			}
 		`,
-			expectedConstants: []interface{}{0},
-			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpStruct, 1),
+			expectedConstants: []interface{}{
+				&object.StructType{
+					Name:   "point2D",
+					Fields: []object.StructField{{Name: "x", Type: "int"}},
+				},
 			},
+			expectedInstructions: []code.Instructions{},
 		},
 		{
 			input: `
@@ -510,16 +866,18 @@ func TestStructStatements(t *testing.T) {
 				point3D {float x, y, z;};
 			}
 		`,
-			expectedConstants: []interface{}{0, 0, 0.0, 0.0, 0.0},
-			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpStruct, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpStruct, 3),
+			expectedConstants: []interface{}{
+				circle,
+				&object.StructType{
+					Name: "point3D",
+					Fields: []object.StructField{
+						{Name: "x", Type: "float"},
+						{Name: "y", Type: "float"},
+						{Name: "z", Type: "float"},
+					},
+				},
 			},
+			expectedInstructions: []code.Instructions{},
 		},
 		{
 			input: `
@@ -531,50 +889,30 @@ func TestStructStatements(t *testing.T) {
 			}
 			c.center;
 		`,
-			expectedConstants: []interface{}{0, 0, &object.Struct{
-				Attributes: map[string]object.Object{
-					"center": &object.Integer{Value: 0},
-					"radius": &object.Integer{Value: 0},
-				},
-			}},
+			expectedConstants: []interface{}{circle, "center"},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpStruct, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpSetGlobal, 1),
-				code.Make(code.OpGetGlobal, 1),
-				code.Make(code.OpGetAttribute, 0),
+				code.Make(code.OpStruct, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetAttribute, 1),
 				code.Make(code.OpPop),
 			},
 		},
-	}
-
-	runCompilerTests(t, tests)
-}
-
-func TestIndexExpressions(t *testing.T) {
-	tests := []compilerTestCase{
 		{
 			input: `
-			global {
-				int a[3] = {1,2,3};
+			structs {
+				circle {int center, int radius;};
 			}
-			a[1 + 1];
-			`,
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			circle c;
+			c.radius = 5;
+		`,
+			expectedConstants: []interface{}{circle, 5, "radius"},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
+				code.Make(code.OpStruct, 0, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpAdd),
-				code.Make(code.OpIndex),
-				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetAttribute, 2),
 			},
 		},
 	}
@@ -582,17 +920,538 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestCompilerScopes(t *testing.T) {
-	compiler := New()
-	if compiler.scopeIndex != 0 {
-		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+func TestStructLiterals(t *testing.T) {
+	point2D := &object.StructType{
+		Name: "point2D",
+		Fields: []object.StructField{
+			{Name: "x", Type: "float"},
+			{Name: "y", Type: "float"},
+		},
 	}
-	globalSymbolTable := compiler.symbolTable
 
-	compiler.emit(code.OpMul)
-
-	compiler.enterScope()
-	if compiler.scopeIndex != 1 {
+	tests := []compilerTestCase{
+		{
+			input: `
+			structs {
+				point2D {float x, y;};
+			}
+			point2D{ y = 2.5 };
+		`,
+			expectedConstants: []interface{}{point2D, "y", 2.5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpStruct, 0, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			structs {
+				point2D {float x, y;};
+			}
+			origin() point2D { }
+		`,
+			expectedConstants: []interface{}{
+				point2D,
+				[]code.Instructions{
+					code.Make(code.OpStruct, 0, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestNestedStructs(t *testing.T) {
+	point := &object.StructType{
+		Name: "point",
+		Fields: []object.StructField{
+			{Name: "x", Type: "int"},
+			{Name: "y", Type: "int"},
+		},
+	}
+
+	tests := []compilerTestCase{
+		{
+			input: `
+			structs {
+				point {int x, y;};
+				line {point a, b;};
+			}
+		`,
+			expectedConstants: []interface{}{
+				point,
+				&object.StructType{
+					Name: "line",
+					Fields: []object.StructField{
+						{Name: "a", Type: "point"},
+						{Name: "b", Type: "point"},
+					},
+				},
+			},
+			expectedInstructions: []code.Instructions{},
+		},
+		{
+			input: `
+			structs {
+				point {int x, y;};
+			}
+			point ps[2];
+			ps[1].x = 3;
+		`,
+			expectedConstants: []interface{}{point, 1, 3, "x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpStruct, 0, 0),
+				code.Make(code.OpFillArray, 2),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetAttribute, 3),
+			},
+		},
+		{
+			input: `
+			int v[1];
+			v[0] = 5;
+		`,
+			expectedConstants: []interface{}{0, 0, 5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{
+			`
+			structs { point2D { float x, y; }; }
+			point2D p;
+			p.z;
+			`,
+			"unknown field z in struct point2D",
+		},
+		{
+			`
+			structs { point2D { float x, y; }; }
+			point2D p;
+			p.x = true;
+			`,
+			"type mismatch: p.x is declared as float, got bool",
+		},
+		{
+			`structs { point2D { float x, x; }; }`,
+			"duplicate field x in struct point2D",
+		},
+		{
+			`
+			structs { point2D { float x; }; }
+			structs { point2D { float y; }; }
+			`,
+			"struct point2D already defined",
+		},
+		{
+			`
+			structs { point2D { float x, y; }; }
+			point2D{ x = 1.0, z = 2.0 };
+			`,
+			"unknown field z in struct point2D",
+		},
+		{
+			`
+			structs { point2D { float x, y; }; }
+			point2D{ x = 1.0, x = 2.0 };
+			`,
+			"duplicate field x in struct literal",
+		},
+		{
+			`
+			structs { point2D { float x, y; }; }
+			point2D{ x = true };
+			`,
+			"type mismatch: point2D.x is declared as float, got bool",
+		},
+		{
+			`point3D{ x = 1.0 };`,
+			"undefined struct point3D",
+		},
+		{
+			`
+			structs { point2D { float x, y; }; point3D { float x, y, z; }; }
+			norm(point2D p) float { norm = p.x; }
+			norm(point3D{ x = 1.0 });
+			`,
+			"type mismatch: argument 1 of norm must be point2D, got point3D",
+		},
+		{
+			`
+			structs { point2D { float x, y; }; }
+			origin() point2D { }
+			origin().z;
+			`,
+			"unknown field z in struct point2D",
+		},
+		{
+			`
+			structs { point2D { float x, y; }; point3D { float x, y, z; }; }
+			global {
+				point2D p = point3D{};
+			}
+			`,
+			"type mismatch: p is declared as point2D, got point3D",
+		},
+		{
+			`structs { line { point a, b; }; }`,
+			"unknown type point",
+		},
+		{
+			`
+			structs { point { int x, y; }; }
+			point ps[2];
+			ps[0].z = 1;
+			`,
+			"unknown field z in struct point",
+		},
+		{
+			`
+			int v[2];
+			v[0] = true;
+			`,
+			"type mismatch: elements of v are int, got bool",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expectedError {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expectedError, err)
+		}
+	}
+}
+
+func TestMultiDimensionalArrays(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			int m[2][2] = {{1, 2}, {3, 4}};
+			m[1][0] = 5;
+			`,
+			expectedConstants: []interface{}{1, 2, 3, 4, 1, 0, 5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpConstant, 6),
+				code.Make(code.OpSetIndex),
+			},
+		},
+		{
+			input: `
+			bool m[2][1];
+			`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpFillArray, 2),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMaps(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			map[string]int m = {"a": 1, "b": 2};
+			m["a"] = 3;
+			m["b"];
+			`,
+			expectedConstants: []interface{}{"a", 1, "b", 2, "a", 3, "b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpMap, 4),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 6),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			map[int]bool m;
+			`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpMap, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMapErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{
+			`map[string]int m = {1: 2};`,
+			"type mismatch: keys of m are string, got int",
+		},
+		{
+			`map[string]int m = {"a": true};`,
+			"type mismatch: values of m are int, got bool",
+		},
+		{
+			`
+			map[string]int m;
+			m["a"] = 1.5;
+			`,
+			"type mismatch: values of m are int, got float",
+		},
+		{
+			`
+			map[string]int m;
+			m[1];
+			`,
+			"type mismatch: keys of m are string, got int",
+		},
+		{
+			`
+			int x;
+			x = {"a": 1};
+			`,
+			"type mismatch: x is declared as int, got a map",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expectedError {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expectedError, err)
+		}
+	}
+}
+
+func TestArrayErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{
+			`int x[3] = {1, 2};`,
+			"array size mismatch: x has 3 elements, got 2",
+		},
+		{
+			`int x[2] = {1, 2, 3};`,
+			"array size mismatch: x has 2 elements, got 3",
+		},
+		{
+			`
+			int x[2];
+			x = {1, 2, 3};
+			`,
+			"array size mismatch: x has 2 elements, got 3",
+		},
+		{
+			`int x[0];`,
+			"size of array x must be positive, got 0",
+		},
+		{
+			`
+			int x[3];
+			push(x, 4);
+			`,
+			"cannot push fixed-size array x of size 3",
+		},
+		{
+			`
+			int x[] = {1, 2};
+			int y[2] = reverse(x);
+			`,
+			"array y with a fixed size must be initialized with an array literal",
+		},
+		{
+			`
+			bool b[] = {true};
+			int x[] = b;
+			`,
+			"type mismatch: x is declared as int[], got bool[]",
+		},
+		{
+			`int m[2][2] = {{1, 2}, {3}};`,
+			"array size mismatch: rows of m have 2 elements, got 1",
+		},
+		{
+			`int m[2][2][1] = {{{1}, {2}}, {{3}, {4, 5}}};`,
+			"array size mismatch: rows of m have 1 elements, got 2",
+		},
+		{
+			`
+			int m[2][2];
+			m[0][1] = true;
+			`,
+			"type mismatch: elements of (m[0]) are int, got bool",
+		},
+		{
+			`
+			int n = 2;
+			int x[n];
+			`,
+			"size of array x must be an integer literal, got n",
+		},
+		{
+			"int a[] = {" + numbers(0, 65536) + "};",
+			"array literal of 65536 elements is too large, the maximum is 65535",
+		},
+		{
+			"int a[] = {" + numbers(0, 40000) + "}; int b[] = {" + numbers(40000, 65537) + "};",
+			"too many constants: 65537, the maximum is 65536",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expectedError {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expectedError, err)
+		}
+	}
+}
+
+// numbers returns the integers from start to end, excluded, as the elements
+// of an array literal.
+func numbers(start, end int) string {
+	elements := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		elements = append(elements, strconv.Itoa(i))
+	}
+	return strings.Join(elements, ", ")
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			global {
+				int a[3] = {1,2,3};
+			}
+			a[1 + 1];
+			`,
+			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpAdd),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `string s = "yail"; s[1:];`,
+			expectedConstants: []interface{}{"yail", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	program := parse(`string s = "yail"; s[0] = "t";`)
+	err := New().Compile(program)
+	expected := "cannot assign to (s[0]): strings are immutable"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("wrong compiler error: want=%q, got=%v", expected, err)
+	}
+}
+
+func TestCompilerScopes(t *testing.T) {
+	compiler := New()
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+	}
+	globalSymbolTable := compiler.symbolTable
+
+	compiler.emit(code.OpMul)
+
+	compiler.enterScope()
+	if compiler.scopeIndex != 1 {
 		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 1)
 	}
 
@@ -646,32 +1505,99 @@ func TestFunctions(t *testing.T) {
 		{
 			input: `
 			add() int {
-				add = 5 + 10;
+				add = 5 + 10;
+			}
+			`,
+			expectedConstants: []interface{}{0, 5, 10, []code.Instructions{
+				code.Make(code.OpConstant, 0), // default result
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: `
+			add() int {
+				5 + 10;
+			}
+			`,
+			expectedConstants: []interface{}{0, 5, 10, []code.Instructions{
+				code.Make(code.OpConstant, 0), // default result
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 0), // implicit return
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: `
+			add() int {
+				1; 2
+			}
+			`,
+			expectedConstants: []interface{}{0, 1, 2, []code.Instructions{
+				code.Make(code.OpConstant, 0), // default result
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 0), // implicit return
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: `
+			add() int {
 			}
 			`,
-			expectedConstants: []interface{}{5, 10, []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
+			expectedConstants: []interface{}{0, []code.Instructions{
+				code.Make(code.OpConstant, 0), // default result
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0), // implicit return
 				code.Make(code.OpReturnValue),
 			}},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 1),
 				code.Make(code.OpSetGlobal, 0),
 			},
 		},
 		{
 			input: `
 			add() int {
-				5 + 10;
+				add = 5;
+				add = add + 10;
 			}
 			`,
-			expectedConstants: []interface{}{5, 10, 0, []code.Instructions{
-				code.Make(code.OpConstant, 0),
+			expectedConstants: []interface{}{0, 5, 10, []code.Instructions{
+				code.Make(code.OpConstant, 0), // default result
+				code.Make(code.OpSetLocal, 0),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpConstant, 2),
 				code.Make(code.OpAdd),
-				code.Make(code.OpPop),
-				code.Make(code.OpConstant, 2), // implicit return
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpReturnValue),
 			}},
 			expectedInstructions: []code.Instructions{
@@ -682,33 +1608,43 @@ func TestFunctions(t *testing.T) {
 		{
 			input: `
 			add() int {
-				1; 2
+				return 5 + 10;
+				add = 1;
 			}
 			`,
-			expectedConstants: []interface{}{1, 2, 0, []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPop),
+			expectedConstants: []interface{}{0, 5, 10, 1, []code.Instructions{
+				code.Make(code.OpConstant, 0), // default result
+				code.Make(code.OpSetLocal, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpPop),
-				code.Make(code.OpConstant, 2), // implicit return
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpReturnValue),
 			}},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
 				code.Make(code.OpSetGlobal, 0),
 			},
 		},
 		{
 			input: `
-			add() int {
+			add() bool {
+				return;
 			}
 			`,
-			expectedConstants: []interface{}{0, []code.Instructions{
-				code.Make(code.OpConstant, 0), // implicit return
+			expectedConstants: []interface{}{[]code.Instructions{
+				code.Make(code.OpFalse), // default result
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpReturnValue),
 			}},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSetGlobal, 0),
 			},
 		},
@@ -726,10 +1662,12 @@ func TestFunctionCalls(t *testing.T) {
 			}
 			add();
 			`,
-			expectedConstants: []interface{}{24, 0, []code.Instructions{
+			expectedConstants: []interface{}{0, 24, []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPop),
+				code.Make(code.OpSetLocal, 0),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpReturnValue),
 			}},
 			expectedInstructions: []code.Instructions{
@@ -745,15 +1683,19 @@ func TestFunctionCalls(t *testing.T) {
 			oneArg(int a) int { oneArg = a; }
 			oneArg(24);
 			`,
-			expectedConstants: []interface{}{[]code.Instructions{
+			expectedConstants: []interface{}{0, []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetLocal, 1),
 				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
 				code.Make(code.OpReturnValue),
 			}, 24},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
 				code.Make(code.OpCall, 1),
 				code.Make(code.OpPop),
 			},
@@ -763,21 +1705,25 @@ func TestFunctionCalls(t *testing.T) {
 			oneArg(int a,b,c) int { oneArg = a + b + c; }
 			oneArg(24,25,26);
 			`,
-			expectedConstants: []interface{}{[]code.Instructions{
+			expectedConstants: []interface{}{0, []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetLocal, 3),
 				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpGetLocal, 1),
 				code.Make(code.OpAdd),
 				code.Make(code.OpGetLocal, 2),
 				code.Make(code.OpAdd),
+				code.Make(code.OpSetLocal, 3),
+				code.Make(code.OpGetLocal, 3),
 				code.Make(code.OpReturnValue),
 			}, 24, 25, 26},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
 				code.Make(code.OpCall, 3),
 				code.Make(code.OpPop),
 			},
@@ -787,6 +1733,299 @@ func TestFunctionCalls(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			countDown(int x) int { countDown = countDown(x - 1); }
+			countDown(1);
+			`,
+			expectedConstants: []interface{}{0, 1, []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSub),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpReturnValue),
+			}, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			isEven(int n) bool { isEven = isOdd(n); }
+			isOdd(int n) bool { isOdd = isEven(n); }
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpFalse),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpFalse),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			// a nested function is a local of the enclosing one, it calls
+			// itself through the function being executed
+			input: `
+			outer() bool {
+				inner(int n) bool { inner = inner(n); }
+			}
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpFalse),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpCurrentFn),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpFalse),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctionValues(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			double(int x) int { double = x * 2; }
+			apply(func(int) int f, int x) int { apply = f(x); }
+			apply(double, 21);
+			`,
+			expectedConstants: []interface{}{
+				0,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpMul),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				0,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+				21,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			noop() func(int) int { }
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpNull), // default result
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctionTypeChecking(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{
+			`
+			isZero(int x) bool { isZero = x == 0; }
+			apply(func(int) int f, int x) int { apply = f(x); }
+			apply(isZero, 1);
+			`,
+			"type mismatch: argument 1 of apply must be func(int) int, got func(int) bool",
+		},
+		{
+			`
+			double(int x) int { double = x * 2; }
+			apply(func(int) int f, int x) int { apply = f(x); }
+			apply(double, true);
+			`,
+			"type mismatch: argument 2 of apply must be int, got bool",
+		},
+		{
+			`
+			apply(func(int) int f, int x) int { apply = f(true); }
+			`,
+			"type mismatch: argument 1 of f must be int, got bool",
+		},
+		{
+			`
+			isZero(int x) bool { isZero = x == 0; }
+			global {
+				func(int) int f = isZero;
+			}
+			`,
+			"type mismatch: f is declared as func(int) int, got func(int) bool",
+		},
+		{
+			`int n = float(3);`,
+			"type mismatch: n is declared as int, got float",
+		},
+		{
+			`f() bool { return 5; }`,
+			"type mismatch: f must return bool, got int",
+		},
+		{
+			`f() int { return "abc"; }`,
+			"type mismatch: f must return int, got string",
+		},
+		{
+			`f() bool { f = 5; }`,
+			"type mismatch: f is declared as bool, got int",
+		},
+		{
+			`int x = 1; x = true;`,
+			"type mismatch: x is declared as int, got bool",
+		},
+		{
+			`
+			isZero(int x) bool { isZero = x == 0; }
+			double(int x) int { double = x * 2; }
+			global {
+				func(int) int f = double;
+			}
+			f = isZero;
+			`,
+			"type mismatch: f is declared as func(int) int, got func(int) bool",
+		},
+		{
+			`
+			int xs[] = {1};
+			int n = int(xs);
+			`,
+			"type mismatch: argument 1 of int must be int|float|bool|string, got int[]",
+		},
+		{
+			`len(1);`,
+			"type mismatch: argument 1 of len must be array|string|map, got int",
+		},
+		{
+			`upper("one", "two");`,
+			"wrong number of arguments for 'upper'. got=2, want=1",
+		},
+		{
+			`min();`,
+			"wrong number of arguments for 'min'. got=0, want at least 1",
+		},
+		{
+			`sin(true);`,
+			"type mismatch: argument 1 of sin must be number, got bool",
+		},
+		{
+			`
+			int a[] = {1};
+			string s = join(a, ",");
+			`,
+			"type mismatch: argument 1 of join must be string[], got int[]",
+		},
+		{
+			`string s = len("one");`,
+			"type mismatch: s is declared as string, got int",
+		},
+		{
+			`PI = 3.0;`,
+			"cannot assign to constant PI",
+		},
+		{
+			`int n = PI;`,
+			"type mismatch: n is declared as int, got float",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expectedError {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expectedError, err)
+		}
+	}
+}
+
 func TestVariableStatementsScopes(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -798,15 +2037,20 @@ func TestVariableStatementsScopes(t *testing.T) {
 				num = a;
 			}
 			`,
-			expectedConstants: []interface{}{33, []code.Instructions{
-				code.Make(code.OpGetGlobal, 0),
+			// functions are declared before anything else, so num is global 0
+			expectedConstants: []interface{}{33, 0, []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpReturnValue),
 			}},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpConstant, 1),
 				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetGlobal, 0),
 			},
 		},
 		{
@@ -818,14 +2062,18 @@ func TestVariableStatementsScopes(t *testing.T) {
 				num = a;
 			}
 			`,
-			expectedConstants: []interface{}{33, []code.Instructions{
+			expectedConstants: []interface{}{0, 33, []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpSetLocal, 0),
 				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpReturnValue),
 			}},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
 				code.Make(code.OpSetGlobal, 0),
 			},
 		},
@@ -839,20 +2087,25 @@ func TestVariableStatementsScopes(t *testing.T) {
 				num = a + b;
 			}
 			`,
-			expectedConstants: []interface{}{33, 33, []code.Instructions{
+			expectedConstants: []interface{}{0, 33, 33, []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSetLocal, 0),
+
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetLocal, 2),
 
-				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpGetLocal, 2),
 				code.Make(code.OpAdd),
+				code.Make(code.OpSetLocal, 0),
 
+				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpReturnValue),
 			}},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
 				code.Make(code.OpSetGlobal, 0),
 			},
 		},
@@ -892,10 +2145,14 @@ func TestBuiltins(t *testing.T) {
 				wow = len(v);
 			}
 			`,
-			expectedConstants: []interface{}{1, 2, 3, []code.Instructions{
+			expectedConstants: []interface{}{1, 2, 3, 0, []code.Instructions{
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSetLocal, 0),
 				code.Make(code.OpGetBuiltin, 0),
-				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetGlobal, 1),
 				code.Make(code.OpCall, 1),
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpReturnValue),
 			}},
 			expectedInstructions: []code.Instructions{
@@ -903,9 +2160,9 @@ func TestBuiltins(t *testing.T) {
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpArray, 3),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpConstant, 3),
 				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpSetGlobal, 0),
 			},
 		},
 	}
@@ -8,19 +8,24 @@ const (
 	GlobalScope  SymbolScope = "GLOBAL"
 	LocalScope   SymbolScope = "LOCAL"
 	BuiltinScope SymbolScope = "BUILTIN"
+
+	// FunctionScope is the scope of the function being compiled, for a
+	// nested function calling itself
+	FunctionScope SymbolScope = "FUNCTION"
 )
 
 type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+	Type  string // The declared type (e.g. "int[]"), empty if unknown
+	Size  int    // The declared size of an array, 0 if unknown
 }
 
 type SymbolStruct struct {
-	Name      string
-	Scope     SymbolScope
-	Index     int
-	Atributes map[string]object.Object
+	Name  string
+	Type  *object.StructType
+	Index int // index of the struct type in the constants
 }
 
 type SymbolTable struct {
@@ -54,39 +59,34 @@ func (s *SymbolTable) Define(name string) Symbol {
 	return symbol
 }
 
-func (s *SymbolTable) DefineStruct(name string) SymbolStruct {
-	symbol := SymbolStruct{
-		Name:      name,
-		Index:     s.numDefinitions,
-		Scope:     GlobalScope,
-		Atributes: make(map[string]object.Object),
-	}
-	s.structs[name] = symbol
-	s.numDefinitions++
+func (s *SymbolTable) DefineWithType(name string, typ string) Symbol {
+	symbol := s.Define(name)
+	symbol.Type = typ
+	s.store[name] = symbol
 	return symbol
 }
 
-func (s *SymbolTable) ResolveStruct(name string) (SymbolStruct, bool) {
-	obj, ok := s.structs[name]
-	return obj, ok
+func (s *SymbolTable) DefineArray(name string, typ string, size int) Symbol {
+	symbol := s.DefineWithType(name, typ)
+	symbol.Size = size
+	s.store[name] = symbol
+	return symbol
 }
 
-func (s *SymbolTable) DefineAttribute(structName string, name string, attr object.Object) SymbolStruct {
-	var symbol SymbolStruct
-	// find the struct
-	sy, ok := s.structs[structName]
-	if !ok {
-		symbol = s.DefineStruct(structName)
-	} else {
-		symbol = sy
-	}
-
-	// define the attribute
-	symbol.Atributes[name] = attr
-
+func (s *SymbolTable) DefineStruct(typ *object.StructType, index int) SymbolStruct {
+	symbol := SymbolStruct{Name: typ.Name, Type: typ, Index: index}
+	s.structs[typ.Name] = symbol
 	return symbol
 }
 
+func (s *SymbolTable) ResolveStruct(name string) (SymbolStruct, bool) {
+	obj, ok := s.structs[name]
+	if !ok && s.Outer != nil {
+		return s.Outer.ResolveStruct(name)
+	}
+	return obj, ok
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	s.store[name] = symbol
@@ -101,3 +101,10 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	}
 	return obj, ok
 }
+
+// ResolveOwn resolves the given name only in the current table, without
+// looking into the outer scopes.
+func (s *SymbolTable) ResolveOwn(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	return obj, ok
+}
@@ -120,22 +120,49 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.MINUS, l.Ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.Ch)
+		if l.peekChar() == '/' {
+			ch := l.Ch
+			l.readChar()
+			literal := string(ch) + string(l.Ch)
+			tok = token.Token{Type: token.FLOOR_DIV, Literal: literal}
+		} else {
+			tok = newToken(token.SLASH, l.Ch)
+		}
 	case '*':
 		if l.peekChar() == '=' {
 			ch := l.Ch
 			l.readChar()
 			literal := string(ch) + string(l.Ch)
 			tok = token.Token{Type: token.MULT_EQ, Literal: literal}
+		} else if l.peekChar() == '*' {
+			ch := l.Ch
+			l.readChar()
+			literal := string(ch) + string(l.Ch)
+			tok = token.Token{Type: token.POWER, Literal: literal}
 		} else {
 			tok = newToken(token.ASTERISK, l.Ch)
 		}
+	case '%':
+		tok = newToken(token.PERCENT, l.Ch)
+	case '&':
+		tok = newToken(token.AMPERSAND, l.Ch)
+	case '|':
+		tok = newToken(token.PIPE, l.Ch)
+	case '^':
+		tok = newToken(token.CARET, l.Ch)
+	case '~':
+		tok = newToken(token.TILDE, l.Ch)
 	case '<':
 		if l.peekChar() == '=' {
 			ch := l.Ch
 			l.readChar()
 			literal := string(ch) + string(l.Ch)
 			tok = token.Token{Type: token.LTE, Literal: literal}
+		} else if l.peekChar() == '<' {
+			ch := l.Ch
+			l.readChar()
+			literal := string(ch) + string(l.Ch)
+			tok = token.Token{Type: token.SHIFT_LEFT, Literal: literal}
 		} else {
 			tok = newToken(token.LT, l.Ch)
 		}
@@ -145,6 +172,11 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.Ch)
 			tok = token.Token{Type: token.GTE, Literal: literal}
+		} else if l.peekChar() == '>' {
+			ch := l.Ch
+			l.readChar()
+			literal := string(ch) + string(l.Ch)
+			tok = token.Token{Type: token.SHIFT_RIGHT, Literal: literal}
 		} else {
 			tok = newToken(token.GT, l.Ch)
 		}
@@ -152,6 +184,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.Ch)
 	case ',':
 		tok = newToken(token.COMMA, l.Ch)
+	case ':':
+		tok = newToken(token.COLON, l.Ch)
 	case '{':
 		tok = newToken(token.LBRACE, l.Ch)
 	case '}':
@@ -59,6 +59,15 @@ structs {
 	point2D { float x, y; };
 	pointND { float x[5]; };
 }
+
+func(int, float) bool f;
+return x;
+break; continue;
+switch (x) { case 1: default: }
+map[string]int m = {"a": 1};
+for (x in a) {}
+a % b // c ** 2;
+~x & y | z ^ 1 << 2 >> 3;
 `
 
 	tests := []struct {
@@ -239,6 +248,82 @@ structs {
 		{token.SEMICOLON, ";"},
 		{token.RBRACE, "}"},
 
+		{token.FUNC, "func"},
+		{token.LPAREN, "("},
+		{token.IDENT, "int"},
+		{token.COMMA, ","},
+		{token.IDENT, "float"},
+		{token.RPAREN, ")"},
+		{token.IDENT, "bool"},
+		{token.IDENT, "f"},
+		{token.SEMICOLON, ";"},
+
+		{token.RETURN, "return"},
+		{token.IDENT, "x"},
+		{token.SEMICOLON, ";"},
+
+		{token.BREAK, "break"},
+		{token.SEMICOLON, ";"},
+		{token.CONTINUE, "continue"},
+		{token.SEMICOLON, ";"},
+
+		{token.SWITCH, "switch"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.CASE, "case"},
+		{token.INT, "1"},
+		{token.COLON, ":"},
+		{token.DEFAULT, "default"},
+		{token.COLON, ":"},
+		{token.RBRACE, "}"},
+
+		{token.MAP, "map"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "string"},
+		{token.RBRACKET, "]"},
+		{token.IDENT, "int"},
+		{token.IDENT, "m"},
+		{token.ASSIGN, "="},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.IDENT, "a"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.FLOOR_DIV, "//"},
+		{token.IDENT, "c"},
+		{token.POWER, "**"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.TILDE, "~"},
+		{token.IDENT, "x"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "y"},
+		{token.PIPE, "|"},
+		{token.IDENT, "z"},
+		{token.CARET, "^"},
+		{token.INT, "1"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.INT, "2"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+
 		{token.EOF, ""},
 	}
 
@@ -17,9 +17,25 @@ func main() {
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "vm":
+			// --checked-arith traps on integer overflows, it may come before
+			// the filepath
+			args := os.Args[2:]
+			checkedArith := len(args) > 0 && args[0] == "--checked-arith"
+			if checkedArith {
+				args = args[1:]
+			}
+
 			// if a filepath is given as an argument, run the file and exit
-			if len(os.Args) > 2 && os.Args[2] != "" {
-				repl.RunFileVm(os.Args[2])
+			if len(args) > 0 && args[0] != "" {
+				// a file is compiled to bytecode but not run, there is no
+				// arithmetic to check
+				if checkedArith {
+					fmt.Printf("--checked-arith only applies to the interactive vm, not to files\n")
+					os.Exit(2)
+					return
+				}
+
+				repl.RunFileVm(args[0])
 				os.Exit(0)
 				return
 			}
@@ -28,7 +44,7 @@ func main() {
 			fmt.Printf("Hello %s!, welcome to YAIL programming language!\n", user.Username)
 			fmt.Printf("Feel free to type in commands\n")
 
-			repl.RunVm(os.Stdin, os.Stdout)
+			repl.RunVm(os.Stdin, os.Stdout, checkedArith)
 			os.Exit(0)
 			return
 
@@ -49,7 +65,7 @@ func main() {
 			return
 		default:
 			fmt.Printf("Please use either vm or ast as an argument\n")
-			fmt.Printf("\nvm: run the virtual machine\n")
+			fmt.Printf("\nvm: run the virtual machine (--checked-arith to trap on integer overflows)\n")
 			fmt.Printf("ast: run the abstract syntax tree\n")
 			os.Exit(0)
 			return
@@ -57,6 +73,6 @@ func main() {
 	}
 
 	fmt.Printf("Please use either vm or ast as an argument\n")
-	fmt.Printf("\nvm: run the virtual machine\n")
+	fmt.Printf("\nvm: run the virtual machine (--checked-arith to trap on integer overflows)\n")
 	fmt.Printf("ast: run the abstract syntax tree\n")
 }
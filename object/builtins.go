@@ -1,241 +1,583 @@
 package object
 
 import (
-	"bufio"
 	"fmt"
 	"math"
-	"os"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-var Builtins = []struct {
-	Name    string
-	Builtin *Builtin
-}{
-	{
-		"len",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			switch arg := args[0].(type) {
-			case *Array:
-				return &Integer{Value: int64(len(arg.Elements))}
-			case *String:
-				return &Integer{Value: int64(len(arg.Value))}
-			default:
-				return newError("argument to `len` not supported, got %s",
-					args[0].Type())
-			}
-		},
-		},
-	},
-	{
-		"pow",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments for 'pow'. got=%d, want=2", len(args))
-			}
-			var base, exponent float64
-
-			// Handle the base argument
-			switch args[0].Type() {
-			case INTEGER_OBJ:
-				base = float64(args[0].(*Integer).Value)
-			case FLOAT_OBJ:
-				base = args[0].(*Float).Value
-			default:
-				return newError("first argument to 'pow' must be INTEGER or FLOAT, got %s", args[0].Type())
-			}
-
-			// Handle the exponent argument
-			switch args[1].Type() {
-			case INTEGER_OBJ:
-				exponent = float64(args[1].(*Integer).Value)
-			case FLOAT_OBJ:
-				exponent = args[1].(*Float).Value
-			default:
-				return newError("second argument to 'pow' must be INTEGER or FLOAT, got %s", args[1].Type())
-			}
-
-			result := math.Pow(base, exponent)
-			return &Float{Value: result}
-		}},
-	},
-	{
-		"square_root",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments for 'square_root'. got=%d, want=1", len(args))
-			}
-			var number float64
-
-			// Handle the number argument
-			switch args[0].Type() {
-			case INTEGER_OBJ:
-				number = float64(args[0].(*Integer).Value)
-			case FLOAT_OBJ:
-				number = args[0].(*Float).Value
-			default:
-				return newError("argument to 'square_root' must be INTEGER or FLOAT, got %s", args[0].Type())
-			}
-
-			if number < 0 {
-				return newError("argument to 'square_root' must be non-negative")
-			}
-
-			result := math.Sqrt(number)
-			return &Float{Value: result}
-		}},
-	},
-	{
-		"gen",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments for 'gen'. got=%d, want=2", len(args))
-			}
-			if args[0].Type() != INTEGER_OBJ || args[1].Type() != INTEGER_OBJ {
-				return newError("arguments to 'gen' must be INTEGERs, got %s and %s", args[0].Type(), args[1].Type())
-			}
-			start := args[0].(*Integer).Value
-			end := args[1].(*Integer).Value
-			result := &Array{}
-			for i := start; i <= end; i++ {
-				result.Elements = append(result.Elements, &Integer{Value: i})
-			}
-			return result
-		}},
-	},
-	{
-		"write",
-		&Builtin{Fn: func(args ...Object) Object {
-			var output []string
-			for _, arg := range args {
-				output = append(output, arg.Inspect())
-			}
-			fmt.Println(strings.Join(output, " "))
-			return nil
-		}},
-	},
-	{
-		"write_all",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments for 'write_all'. got=%d, want=1", len(args))
-			}
-			switch arg := args[0].(type) {
-			case *Array:
+func init() {
+	Builtins.mustRegister(
+		&Builtin{ID: 0, Name: "len", Params: []string{"array|string|map", "int?"}, Return: "int",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				// len(m, d) is the length of the dimension d of a
+				// multi-dimensional array, len(m, 0) being len(m)
+				if len(args) == 2 {
+					if args[0].Type() != ARRAY_OBJ {
+						return newError("only an array has dimensions, got %s", TypeName(args[0]))
+					}
+					return dimensionLength(args[0], args[1].(*Integer).Value)
+				}
+				switch arg := args[0].(type) {
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *String:
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+				default:
+					return &Integer{Value: int64(len(arg.(*Map).Keys))}
+				}
+			}},
+		// a power of integers is an integer, unless the exponent is negative
+		&Builtin{ID: 1, Name: "pow", Params: []string{"number", "number"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				base, isInt := args[0].(*Integer)
+				exponent, isIntExponent := args[1].(*Integer)
+				if isInt && isIntExponent && exponent.Value >= 0 {
+					result, overflow := IntPow(base.Value, exponent.Value)
+					if overflow {
+						return newError("integer overflow: pow(%d, %d)", base.Value, exponent.Value)
+					}
+					return &Integer{Value: result}
+				}
+				return &Float{Value: math.Pow(number(args[0]), number(args[1]))}
+			}},
+		&Builtin{ID: 2, Name: "square_root", Params: []string{"number"}, Return: "float",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				n := number(args[0])
+				if n < 0 {
+					return newError("argument to 'square_root' must be non-negative")
+				}
+				return &Float{Value: math.Sqrt(n)}
+			}},
+		&Builtin{ID: 3, Name: "gen", Params: []string{"int", "int"}, Return: "int[]",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				start := args[0].(*Integer).Value
+				end := args[1].(*Integer).Value
+				if end >= start {
+					n := end - start + 1
+					if n <= 0 { // the range is wider than an int
+						n = math.MaxInt64
+					}
+					if err := allocate(rt, n); err != nil {
+						return err
+					}
+				}
+				result := &Array{}
+				for i := start; i <= end; i++ {
+					result.Elements = append(result.Elements, &Integer{Value: i})
+				}
+				return result
+			}},
+		&Builtin{ID: 4, Name: "write", Params: []string{"any?"}, Variadic: true,
+			Fn: func(rt *Runtime, args ...Object) Object {
 				var output []string
-				for _, el := range arg.Elements {
-					output = append(output, el.Inspect())
+				for _, arg := range args {
+					output = append(output, arg.Inspect())
 				}
-				fmt.Println(strings.Join(output, ", "))
-			case *Struct:
+				fmt.Fprintln(rt.Out, strings.Join(output, " "))
+				return nil
+			}},
+		&Builtin{ID: 5, Name: "write_all", Params: []string{"array|struct"},
+			Fn: func(rt *Runtime, args ...Object) Object {
 				var output []string
-				for _, el := range arg.Attributes {
-					output = append(output, el.Inspect())
-				}
-				fmt.Println(strings.Join(output, ", "))
-			default:
-				return newError("argument to 'write_all' must be ARRAY or STRUCT, got %s", args[0].Type())
-			}
-			return nil
-		}},
-	}, {
-		"write_string",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments for 'write_string'. got=%d, want=1", len(args))
-			}
-			switch arg := args[0].(type) {
-			case *Array:
-				for _, el := range arg.Elements {
-					if intEl, ok := el.(*Integer); ok {
-						fmt.Print(string(rune(intEl.Value)))
+				switch arg := args[0].(type) {
+				case *Array:
+					for _, el := range arg.Elements {
+						output = append(output, el.Inspect())
+					}
+				case *Struct:
+					for _, name := range arg.FieldNames() {
+						output = append(output, arg.Attributes[name].Inspect())
+					}
+				}
+				fmt.Fprintln(rt.Out, strings.Join(output, ", "))
+				return nil
+			}},
+		&Builtin{ID: 6, Name: "write_string", Params: []string{"int[]"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				for _, el := range args[0].(*Array).Elements {
+					fmt.Fprint(rt.Out, string(rune(el.(*Integer).Value)))
+				}
+				fmt.Fprintln(rt.Out)
+				return nil
+			}},
+		&Builtin{ID: 7, Name: "read", Return: "string",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				line, _ := rt.In.ReadString('\n')
+				return &String{Value: line}
+			}},
+		&Builtin{ID: 8, Name: "read_all", Params: []string{"array|struct"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				switch arg := args[0].(type) {
+				case *Array:
+					for i := range arg.Elements {
+						fmt.Fprintf(rt.Out, "v[%d]: ", i)
+						input, _ := rt.In.ReadString('\n')
+						arg.Elements[i] = &Integer{Value: parseInput(input)}
+					}
+				case *Struct:
+					for _, key := range arg.FieldNames() {
+						fmt.Fprintf(rt.Out, "struct %s\n%s: ", arg.StructType.Name, key)
+						input, _ := rt.In.ReadString('\n')
+						arg.Attributes[key] = &Integer{Value: parseInput(input)}
+					}
+				}
+				return nil
+			}},
+		&Builtin{ID: 9, Name: "read_string", Params: []string{"int[]"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				arg := args[0].(*Array)
+				input, _ := rt.In.ReadString('\n')
+				input = strings.TrimSuffix(input, "\n") // remove the newline character at the end
+				for i, ch := range input {
+					if i < len(arg.Elements) {
+						arg.Elements[i] = &Integer{Value: int64(ch)}
 					} else {
-						return newError("write_string array elements must be INTEGERS, got %s", el.Type())
+						break
+					}
+				}
+				for i := len(input); i < len(arg.Elements); i++ { // fill the rest with zeros
+					arg.Elements[i] = &Integer{Value: 0}
+				}
+				return nil
+			}},
+		// push, pop, insert and remove change the array they are given, the
+		// other array builtins leave their arguments untouched and return a new
+		// array
+		&Builtin{ID: 10, Name: "push", Params: []string{"array", "any"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				if err := allocate(rt, 1); err != nil {
+					return err
+				}
+				arr := args[0].(*Array)
+				arr.Elements = append(arr.Elements, storedValue(args[1]))
+				return nil
+			}},
+		&Builtin{ID: 11, Name: "pop", Params: []string{"array"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				arr := args[0].(*Array)
+				if len(arr.Elements) == 0 {
+					return newError("pop from empty array")
+				}
+				last := arr.Elements[len(arr.Elements)-1]
+				arr.Elements = arr.Elements[:len(arr.Elements)-1]
+				return last
+			}},
+		&Builtin{ID: 12, Name: "insert", Params: []string{"array", "int", "any"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				arr, i := args[0].(*Array), args[1].(*Integer).Value
+				if i < 0 || i > int64(len(arr.Elements)) {
+					return newError("index out of range: %d (length %d)", i, len(arr.Elements))
+				}
+				if err := allocate(rt, 1); err != nil {
+					return err
+				}
+				arr.Elements = append(arr.Elements, nil)
+				copy(arr.Elements[i+1:], arr.Elements[i:])
+				arr.Elements[i] = storedValue(args[2])
+				return nil
+			}},
+		&Builtin{ID: 13, Name: "remove", Params: []string{"array", "int"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				arr, i := args[0].(*Array), args[1].(*Integer).Value
+				if i < 0 || i >= int64(len(arr.Elements)) {
+					return newError("index out of range: %d (length %d)", i, len(arr.Elements))
+				}
+				removed := arr.Elements[i]
+				arr.Elements = append(arr.Elements[:i], arr.Elements[i+1:]...)
+				return removed
+			}},
+		&Builtin{ID: 14, Name: "slice", Params: []string{"array", "int", "int"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				arr := args[0].(*Array)
+				lo, hi := args[1].(*Integer).Value, args[2].(*Integer).Value
+				if lo < 0 || hi > int64(len(arr.Elements)) || lo > hi {
+					return newError("slice bounds out of range: [%d:%d] (length %d)", lo, hi, len(arr.Elements))
+				}
+				if err := allocate(rt, hi-lo); err != nil {
+					return err
+				}
+				return copyElements(arr.Elements[lo:hi])
+			}},
+		&Builtin{ID: 15, Name: "concat", Params: []string{"array", "array"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				a, b := args[0].(*Array), args[1].(*Array)
+				if err := allocate(rt, int64(len(a.Elements)+len(b.Elements))); err != nil {
+					return err
+				}
+				elements := make([]Object, 0, len(a.Elements)+len(b.Elements))
+				elements = append(elements, a.Elements...)
+				return copyElements(append(elements, b.Elements...))
+			}},
+		&Builtin{ID: 16, Name: "reverse", Params: []string{"array"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				elements := args[0].(*Array).Elements
+				if err := allocate(rt, int64(len(elements))); err != nil {
+					return err
+				}
+				result := copyElements(elements)
+				for i, j := 0, len(result.Elements)-1; i < j; i, j = i+1, j-1 {
+					result.Elements[i], result.Elements[j] = result.Elements[j], result.Elements[i]
+				}
+				return result
+			}},
+		&Builtin{ID: 17, Name: "contains", Params: []string{"array", "any"}, Return: "bool",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return &Boolean{Value: indexOf(args[0].(*Array), args[1]) >= 0}
+			}},
+		&Builtin{ID: 18, Name: "index_of", Params: []string{"array", "any"}, Return: "int",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return &Integer{Value: int64(indexOf(args[0].(*Array), args[1]))}
+			}},
+		&Builtin{ID: 19, Name: "keys", Params: []string{"map"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				if err := allocate(rt, int64(len(args[0].(*Map).Keys))); err != nil {
+					return err
+				}
+				result := &Array{Elements: []Object{}}
+				for _, pair := range args[0].(*Map).Entries() {
+					result.Elements = append(result.Elements, pair.Key)
+				}
+				return result
+			}},
+		&Builtin{ID: 20, Name: "values", Params: []string{"map"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				if err := allocate(rt, int64(len(args[0].(*Map).Keys))); err != nil {
+					return err
+				}
+				result := &Array{Elements: []Object{}}
+				for _, pair := range args[0].(*Map).Entries() {
+					result.Elements = append(result.Elements, storedValue(pair.Value))
+				}
+				return result
+			}},
+		&Builtin{ID: 21, Name: "has", Params: []string{"map", "any"}, Return: "bool",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				key, ok := args[1].(Hashable)
+				if !ok {
+					return newError("unusable as map key: %s", args[1].Type())
+				}
+				_, found := args[0].(*Map).Get(key)
+				return &Boolean{Value: found}
+			}},
+		&Builtin{ID: 22, Name: "delete", Params: []string{"map", "any"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				key, ok := args[1].(Hashable)
+				if !ok {
+					return newError("unusable as map key: %s", args[1].Type())
+				}
+				args[0].(*Map).Delete(key)
+				return nil
+			}},
+		&Builtin{ID: 23, Name: "split", Params: []string{"string", "string"}, Return: "string[]",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				parts := strings.Split(str(args[0]), str(args[1]))
+				if err := allocate(rt, int64(len(parts)+len(str(args[0])))); err != nil {
+					return err
+				}
+				result := &Array{Elements: []Object{}}
+				for _, part := range parts {
+					result.Elements = append(result.Elements, &String{Value: part})
+				}
+				return result
+			}},
+		&Builtin{ID: 24, Name: "join", Params: []string{"string[]", "string"}, Return: "string",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				elements := args[0].(*Array).Elements
+				parts := make([]string, len(elements))
+				for i, e := range elements {
+					parts[i] = str(e)
+				}
+				return newString(rt, strings.Join(parts, str(args[1])))
+			}},
+		&Builtin{ID: 25, Name: "trim", Params: []string{"string"}, Return: "string",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return newString(rt, strings.TrimSpace(str(args[0])))
+			}},
+		&Builtin{ID: 26, Name: "upper", Params: []string{"string"}, Return: "string",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return newString(rt, strings.ToUpper(str(args[0])))
+			}},
+		&Builtin{ID: 27, Name: "lower", Params: []string{"string"}, Return: "string",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return newString(rt, strings.ToLower(str(args[0])))
+			}},
+		&Builtin{ID: 28, Name: "replace", Params: []string{"string", "string", "string"}, Return: "string",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return newString(rt, strings.ReplaceAll(str(args[0]), str(args[1]), str(args[2])))
+			}},
+		&Builtin{ID: 29, Name: "find", Params: []string{"string", "string"}, Return: "int",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				s := str(args[0])
+				// the position is counted in characters, like indexing
+				i := strings.Index(s, str(args[1]))
+				if i >= 0 {
+					i = utf8.RuneCountInString(s[:i])
+				}
+				return &Integer{Value: int64(i)}
+			}},
+		&Builtin{ID: 30, Name: "starts_with", Params: []string{"string", "string"}, Return: "bool",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return &Boolean{Value: strings.HasPrefix(str(args[0]), str(args[1]))}
+			}},
+		&Builtin{ID: 31, Name: "to_chars", Params: []string{"string"}, Return: "int[]",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				if err := allocate(rt, int64(utf8.RuneCountInString(str(args[0])))); err != nil {
+					return err
+				}
+				result := &Array{Elements: []Object{}}
+				for _, r := range str(args[0]) {
+					result.Elements = append(result.Elements, &Integer{Value: int64(r)})
+				}
+				return result
+			}},
+		&Builtin{ID: 32, Name: "from_chars", Params: []string{"int[]"}, Return: "string",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				elements := args[0].(*Array).Elements
+				runes := make([]rune, len(elements))
+				for i, e := range elements {
+					runes[i] = rune(e.(*Integer).Value)
+				}
+				return newString(rt, string(runes))
+			}},
+		&Builtin{ID: 33, Name: "seed", Params: []string{"int"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				rt.Rand.Seed(args[0].(*Integer).Value)
+				return nil
+			}},
+		&Builtin{ID: 34, Name: "rand_int", Params: []string{"int", "int"}, Return: "int",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				lo, hi := args[0].(*Integer).Value, args[1].(*Integer).Value
+				// both bounds are included, like the bounds of a for loop
+				if lo > hi {
+					return newError("empty range for 'rand_int': [%d, %d]", lo, hi)
+				}
+				return &Integer{Value: randRange(rt, lo, hi)}
+			}},
+		&Builtin{ID: 35, Name: "rand_float", Return: "float",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return &Float{Value: rt.Rand.Float64()}
+			}},
+		&Builtin{ID: 36, Name: "shuffle", Params: []string{"array"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				arr := args[0].(*Array)
+				rt.Rand.Shuffle(len(arr.Elements), func(i, j int) {
+					arr.Elements[i], arr.Elements[j] = arr.Elements[j], arr.Elements[i]
+				})
+				return nil
+			}},
+		// the conversions are named after the type they convert to
+		&Builtin{ID: 37, Name: "int", Params: []string{"int|float|bool|string"}, Return: "int",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				switch arg := args[0].(type) {
+				case *Float:
+					// floats are truncated toward zero, the ones out of the
+					// range of an int (infinities included) are rejected
+					if math.IsNaN(arg.Value) || arg.Value >= 1<<63 || arg.Value < -1<<63 {
+						return newError("cannot convert %s to int", arg.Inspect())
+					}
+					return &Integer{Value: int64(arg.Value)}
+				case *Boolean:
+					if arg.Value {
+						return &Integer{Value: 1}
+					}
+					return &Integer{Value: 0}
+				case *String:
+					value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+					if err != nil {
+						return newError("cannot convert %q to int", arg.Value)
+					}
+					return &Integer{Value: value}
+				default:
+					return arg
+				}
+			}},
+		&Builtin{ID: 38, Name: "float", Params: []string{"int|float|bool|string"}, Return: "float",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				switch arg := args[0].(type) {
+				case *Integer:
+					return &Float{Value: float64(arg.Value)}
+				case *Boolean:
+					if arg.Value {
+						return &Float{Value: 1}
+					}
+					return &Float{Value: 0}
+				case *String:
+					value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+					if err != nil {
+						return newError("cannot convert %q to float", arg.Value)
 					}
+					return &Float{Value: value}
+				default:
+					return arg
 				}
-				fmt.Println()
-			default:
-				return newError("argument to 'write_string' must be ARRAY, got %s", args[0].Type())
-			}
-			return nil
-		}},
-	},
-	{
-		"read",
-		&Builtin{Fn: func(args ...Object) Object {
-			reader := bufio.NewReader(os.Stdin)
-			line, _ := reader.ReadString('\n')
-			return &String{Value: line}
-		}},
-	},
-	{
-		"read_all",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments for 'read_all'. got=%d, want=1", len(args))
-			}
-			reader := bufio.NewReader(os.Stdin)
-			switch arg := args[0].(type) {
-			case *Array:
-				for i := range arg.Elements {
-					fmt.Printf("v[%d]: ", i)
-					input, _ := reader.ReadString('\n')
-					arg.Elements[i] = &Integer{Value: parseInput(input)}
-				}
-			case *Struct:
-				for key := range arg.Attributes {
-					fmt.Printf("struct %s\n%s: ", arg.Type(), key)
-					input, _ := reader.ReadString('\n')
-					arg.Attributes[key] = &Integer{Value: parseInput(input)}
-				}
-			default:
-				return newError("argument to 'read_all' must be ARRAY or STRUCT, got %s", args[0].Type())
-			}
-			return nil
-		}},
-	},
-	{
-		"read_string",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments for 'read_string'. got=%d, want=1", len(args))
-			}
-			arg, ok := args[0].(*Array)
-			if !ok {
-				return newError("argument to 'read_string' must be ARRAY, got %s", args[0].Type())
-			}
-			reader := bufio.NewReader(os.Stdin)
-			input, _ := reader.ReadString('\n')
-			input = strings.TrimSuffix(input, "\n") // remove the newline character at the end
-			for i, ch := range input {
-				if i < len(arg.Elements) {
-					arg.Elements[i] = &Integer{Value: int64(ch)}
-				} else {
-					break
-				}
-			}
-			for i := len(input); i < len(arg.Elements); i++ { // fill the rest with zeros
-				arg.Elements[i] = &Integer{Value: 0}
-			}
-			return nil
-		}},
-	},
+			}},
+		&Builtin{ID: 39, Name: "bool", Params: []string{"int|float|bool|string"}, Return: "bool",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				switch arg := args[0].(type) {
+				case *Integer:
+					return &Boolean{Value: arg.Value != 0}
+				case *Float:
+					return &Boolean{Value: arg.Value != 0}
+				case *String:
+					switch strings.TrimSpace(arg.Value) {
+					case "true":
+						return &Boolean{Value: true}
+					case "false":
+						return &Boolean{Value: false}
+					default:
+						return newError("cannot convert %q to bool", arg.Value)
+					}
+				default:
+					return arg
+				}
+			}},
+		&Builtin{ID: 40, Name: "string", Params: []string{"int|float|bool|string"}, Return: "string",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				if arg, ok := args[0].(*String); ok {
+					return arg
+				}
+				return &String{Value: args[0].Inspect()}
+			}},
+	)
 }
 
-func GetBuiltinByName(name string) *Builtin {
-	for _, def := range Builtins {
-		if def.Name == name {
-			return def.Builtin
+// intPow returns base raised to the non-negative exponent, by squaring, and
+// whether the result overflowed.
+func IntPow(base, exponent int64) (int64, bool) {
+	result, overflow := int64(1), false
+	for exponent > 0 {
+		var o bool
+		if exponent&1 == 1 {
+			result, o = IntMul(result, base)
+			overflow = overflow || o
+		}
+		exponent >>= 1
+		if exponent > 0 {
+			base, o = IntMul(base, base)
+			overflow = overflow || o
 		}
 	}
+	return result, overflow
+}
+
+// intMul returns a * b, and whether the product overflowed.
+func IntMul(a, b int64) (int64, bool) {
+	result := a * b
+	if a == 0 || b == 0 {
+		return result, false
+	}
+	// the smallest integer times -1 wraps around to itself, which would
+	// divide back correctly
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return result, true
+	}
+	return result, result/b != a
+}
+
+// randRange returns a random integer in [lo, hi], lo <= hi. Ranges wider than
+// an int64 are drawn from 64 random bits, discarding the draws which would
+// favour some values over others.
+func randRange(rt *Runtime, lo, hi int64) int64 {
+	span := uint64(hi) - uint64(lo)
+	if span < math.MaxInt64 {
+		return lo + rt.Rand.Int63n(int64(span)+1)
+	}
+	if span == math.MaxUint64 {
+		return int64(rt.Rand.Uint64())
+	}
+
+	n := span + 1
+	limit := math.MaxUint64 - (math.MaxUint64%n+1)%n
+	for {
+		v := rt.Rand.Uint64()
+		if v <= limit {
+			return int64(uint64(lo) + v%n)
+		}
+	}
+}
+
+// allocate accounts for n values allocated by a builtin, see Runtime.Allocate.
+func allocate(rt *Runtime, n int64) *Error {
+	if !rt.Allocate(n) {
+		return newError("memory limit exceeded")
+	}
 	return nil
 }
 
+// newString returns a string built by a builtin, within the allocation limit.
+func newString(rt *Runtime, s string) Object {
+	if err := allocate(rt, int64(len(s))); err != nil {
+		return err
+	}
+	return &String{Value: s}
+}
+
+// number returns the value of an INTEGER or FLOAT.
+func number(obj Object) float64 {
+	if integer, ok := obj.(*Integer); ok {
+		return float64(integer.Value)
+	}
+	return obj.(*Float).Value
+}
+
+// str returns the value of a STRING.
+func str(obj Object) string {
+	return obj.(*String).Value
+}
+
+// storedValue returns the value stored in an array by push and insert, structs
+// are copied so that the array doesn't share them with the caller.
+func storedValue(obj Object) Object {
+	if strct, ok := obj.(*Struct); ok {
+		return strct.Copy()
+	}
+	return obj
+}
+
+// copyElements returns a new array holding the given elements.
+func copyElements(elements []Object) *Array {
+	result := &Array{Elements: make([]Object, len(elements))}
+	for i, e := range elements {
+		result.Elements[i] = storedValue(e)
+	}
+	return result
+}
+
+// indexOf returns the position of the first element of arr equal to obj, or
+// -1 if there is none.
+func indexOf(arr *Array, obj Object) int {
+	for i, e := range arr.Elements {
+		if equal(e, obj) {
+			return i
+		}
+	}
+	return -1
+}
+
+// equal reports whether two objects hold the same value, arrays and structs
+// are compared element by element.
+func equal(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *Float:
+		return a.Value == b.(*Float).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	default:
+		return a.Inspect() == b.Inspect()
+	}
+}
+
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -248,3 +590,23 @@ func parseInput(input string) int64 {
 	}
 	return num
 }
+
+// dimensionLength returns the length of the dimension dim of an array, given
+// by its first row at each level.
+func dimensionLength(arr Object, dim int64) Object {
+	for i := int64(0); ; i++ {
+		a, ok := arr.(*Array)
+		if !ok {
+			return newError("array has no dimension %d", dim)
+		}
+
+		if i == dim {
+			return &Integer{Value: int64(len(a.Elements))}
+		}
+
+		if dim < 0 || len(a.Elements) == 0 {
+			return newError("array has no dimension %d", dim)
+		}
+		arr = a.Elements[0]
+	}
+}
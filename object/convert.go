@@ -0,0 +1,494 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Go values are converted to objects and back as follows: integers are
+// Integers, floats are Floats, bools are Booleans, strings are Strings, slices
+// and arrays are Arrays, maps are Maps and structs are Structs. The name of a
+// struct field is the one of its `yail` tag, or the name of the Go field
+// itself, and a field tagged `yail:"-"` is left out. Pointers are followed,
+// and an Object is converted as it is.
+
+var objectType = reflect.TypeOf((*Object)(nil)).Elem()
+
+// FromGo converts a Go value to an object.
+func FromGo(v interface{}) (Object, error) {
+	if v == nil {
+		return nil, fmt.Errorf("cannot convert nil to a YAIL value")
+	}
+	return fromGo(reflect.ValueOf(v))
+}
+
+func fromGo(v reflect.Value) (Object, error) {
+	if obj, ok := v.Interface().(Object); ok && !(v.Kind() == reflect.Pointer && v.IsNil()) {
+		return obj, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, fmt.Errorf("cannot convert %d to int: overflow", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.Bool:
+		return &Boolean{Value: v.Bool()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		arr := &Array{Elements: make([]Object, v.Len())}
+		for i := range arr.Elements {
+			e, err := fromGo(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			arr.Elements[i] = e
+		}
+		return arr, nil
+	case reflect.Map:
+		return mapFromGo(v)
+	case reflect.Struct:
+		return structFromGo(v)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, fmt.Errorf("cannot convert nil %s to a YAIL value", v.Type())
+		}
+		return fromGo(v.Elem())
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a YAIL value", v.Type())
+	}
+}
+
+// mapFromGo converts a Go map, whose pairs are added in the order of their
+// keys since Go maps are not ordered.
+func mapFromGo(v reflect.Value) (Object, error) {
+	type pair struct {
+		key   Hashable
+		value Object
+	}
+
+	pairs := make([]pair, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := fromGo(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as map key: %s", key.Type())
+		}
+
+		value, err := fromGo(iter.Value())
+		if err != nil {
+			return nil, fmt.Errorf("value of %s: %w", key.Inspect(), err)
+		}
+		pairs = append(pairs, pair{hashable, value})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return less(pairs[i].key.(Object), pairs[j].key.(Object))
+	})
+
+	m := NewMap()
+	for _, p := range pairs {
+		m.Set(p.key, p.value)
+	}
+	return m, nil
+}
+
+// less orders the keys of a map, keys of different types being ordered by
+// type.
+func less(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
+
+func structFromGo(v reflect.Value) (Object, error) {
+	st := structTypeFromGo(v.Type())
+	strct := &Struct{StructType: st, Attributes: make(map[string]Object, len(st.Fields))}
+	for i, f := range goFields(v.Type()) {
+		value, err := fromGo(v.FieldByIndex(f.Index))
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", st.Fields[i].Name, err)
+		}
+		strct.Attributes[st.Fields[i].Name] = value
+	}
+	return strct, nil
+}
+
+// structTypeFromGo returns the struct type of the values of a Go struct type,
+// named after it.
+func structTypeFromGo(t reflect.Type) *StructType {
+	st := &StructType{Name: t.Name()}
+	for _, f := range goFields(t) {
+		field := StructField{Name: fieldName(f), Type: TypeFromGo(f.Type)}
+
+		zero, err := fromGo(reflect.Zero(f.Type))
+		if err == nil {
+			field.Default = zero
+		}
+		st.Fields = append(st.Fields, field)
+	}
+	return st
+}
+
+// goFields returns the exported fields of a Go struct type which are not
+// tagged `yail:"-"`.
+func goFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("yail") == "-" {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func fieldName(f reflect.StructField) string {
+	if name := f.Tag.Get("yail"); name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// TypeFromGo returns the name of the type the type checker gives to the
+// conversion of a value of the Go type t, "" if it doesn't have one.
+func TypeFromGo(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if elem := TypeFromGo(t.Elem()); elem != "" {
+			return elem + "[]"
+		}
+	case reflect.Map:
+		key, value := TypeFromGo(t.Key()), TypeFromGo(t.Elem())
+		if key != "" && value != "" {
+			return "map[" + key + "]" + value
+		}
+	case reflect.Struct:
+		return t.Name()
+	case reflect.Pointer:
+		return TypeFromGo(t.Elem())
+	}
+	return ""
+}
+
+// ToGo converts an object to a Go value, stored where target points to.
+func ToGo(obj Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("target of the conversion must be a non-nil pointer, got %T", target)
+	}
+	return toGo(obj, v.Elem())
+}
+
+func toGo(obj Object, v reflect.Value) error {
+	if v.Type() == objectType {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	mismatch := fmt.Errorf("cannot convert %s to %s", TypeName(obj), v.Type())
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return mismatch
+		}
+		if v.OverflowInt(integer.Value) {
+			return fmt.Errorf("cannot convert %d to %s: overflow", integer.Value, v.Type())
+		}
+		v.SetInt(integer.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return mismatch
+		}
+		if integer.Value < 0 || v.OverflowUint(uint64(integer.Value)) {
+			return fmt.Errorf("cannot convert %d to %s: overflow", integer.Value, v.Type())
+		}
+		v.SetUint(uint64(integer.Value))
+	case reflect.Float32, reflect.Float64:
+		// an int is accepted where a float is expected, like in assignments
+		switch obj := obj.(type) {
+		case *Float:
+			v.SetFloat(obj.Value)
+		case *Integer:
+			v.SetFloat(float64(obj.Value))
+		default:
+			return mismatch
+		}
+	case reflect.Bool:
+		boolean, ok := obj.(*Boolean)
+		if !ok {
+			return mismatch
+		}
+		v.SetBool(boolean.Value)
+	case reflect.String:
+		str, ok := obj.(*String)
+		if !ok {
+			return mismatch
+		}
+		v.SetString(str.Value)
+	case reflect.Slice:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return mismatch
+		}
+		slice := reflect.MakeSlice(v.Type(), len(arr.Elements), len(arr.Elements))
+		if err := elementsToGo(arr.Elements, slice); err != nil {
+			return err
+		}
+		v.Set(slice)
+	case reflect.Array:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return mismatch
+		}
+		if len(arr.Elements) != v.Len() {
+			return fmt.Errorf("cannot convert an array of length %d to %s", len(arr.Elements), v.Type())
+		}
+		return elementsToGo(arr.Elements, v)
+	case reflect.Map:
+		m, ok := obj.(*Map)
+		if !ok {
+			return mismatch
+		}
+		result := reflect.MakeMapWithSize(v.Type(), len(m.Keys))
+		for _, pair := range m.Entries() {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := toGo(pair.Key, key); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := toGo(pair.Value, value); err != nil {
+				return fmt.Errorf("value of %s: %w", pair.Key.Inspect(), err)
+			}
+			result.SetMapIndex(key, value)
+		}
+		v.Set(result)
+	case reflect.Struct:
+		strct, ok := obj.(*Struct)
+		if !ok {
+			return mismatch
+		}
+		// the fields missing from the struct keep their zero value
+		for _, f := range goFields(v.Type()) {
+			name := fieldName(f)
+			value, ok := strct.Attributes[name]
+			if !ok {
+				continue
+			}
+			if err := toGo(value, v.FieldByIndex(f.Index)); err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+		}
+	case reflect.Pointer:
+		ptr := reflect.New(v.Type().Elem())
+		if err := toGo(obj, ptr.Elem()); err != nil {
+			return err
+		}
+		v.Set(ptr)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return mismatch
+		}
+		value, err := plainGo(obj)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+func elementsToGo(elements []Object, v reflect.Value) error {
+	for i, e := range elements {
+		if err := toGo(e, v.Index(i)); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// plainGo converts an object stored in an empty interface: to an int64, a
+// float64, a bool, a string, a []interface{}, a map[interface{}]interface{}
+// or, for a struct, a map[string]interface{}.
+func plainGo(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, nil
+	case *Float:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Null:
+		return nil, nil
+	case *Array:
+		result := make([]interface{}, len(obj.Elements))
+		for i, e := range obj.Elements {
+			value, err := plainGo(e)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			result[i] = value
+		}
+		return result, nil
+	case *Map:
+		result := make(map[interface{}]interface{}, len(obj.Keys))
+		for _, pair := range obj.Entries() {
+			key, _ := plainGo(pair.Key)
+			value, err := plainGo(pair.Value)
+			if err != nil {
+				return nil, fmt.Errorf("value of %s: %w", pair.Key.Inspect(), err)
+			}
+			result[key] = value
+		}
+		return result, nil
+	case *Struct:
+		result := make(map[string]interface{}, len(obj.Attributes))
+		for name, attribute := range obj.Attributes {
+			value, err := plainGo(attribute)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			result[name] = value
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", TypeName(obj))
+	}
+}
+
+// BuiltinFromGo returns a builtin calling the Go function fn, whose parameters
+// and result are converted with ToGo and FromGo. fn may return nothing, a
+// value, an error, or a value and an error; an error is returned to the
+// program as an Error. The parameters of the builtin are derived from the
+// ones of fn, e.g. a float64 parameter accepts any number.
+func BuiltinFromGo(name string, fn interface{}) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("builtin %s must be a function, got %T", name, fn)
+	}
+
+	t := v.Type()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	numValues := t.NumOut()
+	if returnsError {
+		numValues--
+	}
+	if numValues > 1 {
+		return nil, fmt.Errorf("builtin %s must return at most one value and an error", name)
+	}
+
+	b := &Builtin{Name: name, Variadic: t.IsVariadic()}
+	for i := 0; i < t.NumIn(); i++ {
+		param := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			b.Params = append(b.Params, paramFromGo(param.Elem())+"?")
+		} else {
+			b.Params = append(b.Params, paramFromGo(param))
+		}
+	}
+	if numValues == 1 {
+		b.Return = TypeFromGo(t.Out(0))
+	}
+
+	b.Fn = func(rt *Runtime, args ...Object) Object {
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var param reflect.Type
+			if t.IsVariadic() && i >= t.NumIn()-1 {
+				param = t.In(t.NumIn() - 1).Elem()
+			} else {
+				param = t.In(i)
+			}
+
+			in[i] = reflect.New(param).Elem()
+			if err := toGo(arg, in[i]); err != nil {
+				return newError("argument %d to '%s': %s", i+1, name, err)
+			}
+		}
+
+		out := v.Call(in)
+		if returnsError && !out[len(out)-1].IsNil() {
+			return newError("%s", out[len(out)-1].Interface().(error))
+		}
+		if numValues == 0 {
+			return nil
+		}
+
+		result, err := fromGo(out[0])
+		if err != nil {
+			return newError("result of '%s': %s", name, err)
+		}
+		return result
+	}
+
+	return b, nil
+}
+
+// paramFromGo returns the type of the builtin parameter receiving a value of
+// the Go type t, written as described in Registry.
+func paramFromGo(t reflect.Type) string {
+	if t == objectType || t.Kind() == reflect.Interface {
+		return "any"
+	}
+
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if elem := paramFromGo(t.Elem()); elem != "any" {
+			return elem + "[]"
+		}
+		return "array"
+	case reflect.Map:
+		return "map"
+	case reflect.Struct:
+		return "struct"
+	case reflect.Pointer:
+		return paramFromGo(t.Elem())
+	}
+
+	if typ := TypeFromGo(t); typ != "" {
+		return typ
+	}
+	return "any"
+}
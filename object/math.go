@@ -0,0 +1,172 @@
+package object
+
+import "math"
+
+// Constants are the named values predefined by the language. A variable with
+// the same name shadows them.
+var Constants = map[string]Object{
+	"PI":  &Float{Value: math.Pi},
+	"E":   &Float{Value: math.E},
+	"INF": &Float{Value: math.Inf(1)},
+	"NAN": &Float{Value: math.NaN()},
+}
+
+// The builtins of the math library. Functions that only move a number around
+// (abs, min, floor, ...) return an Integer when given Integers, the others
+// always return a Float.
+func init() {
+	Builtins.mustRegister(
+		&Builtin{ID: 41, Name: "abs", Params: []string{"number"},
+			Fn: func(rt *Runtime, args ...Object) Object {
+				switch arg := args[0].(type) {
+				case *Integer:
+					// the smallest int has no positive counterpart
+					if arg.Value == math.MinInt64 {
+						return newError("integer overflow: abs(%d)", arg.Value)
+					}
+					if arg.Value < 0 {
+						return &Integer{Value: -arg.Value}
+					}
+					return arg
+				default:
+					return &Float{Value: math.Abs(number(arg))}
+				}
+			}},
+		&Builtin{ID: 42, Name: "min", Params: []string{"number"}, Variadic: true,
+			Fn: extremum(-1)},
+		&Builtin{ID: 43, Name: "max", Params: []string{"number"}, Variadic: true,
+			Fn: extremum(1)},
+		&Builtin{ID: 44, Name: "floor", Params: []string{"number"}, Fn: rounding(math.Floor)},
+		&Builtin{ID: 45, Name: "ceil", Params: []string{"number"}, Fn: rounding(math.Ceil)},
+		&Builtin{ID: 46, Name: "round", Params: []string{"number"}, Fn: rounding(math.Round)},
+		&Builtin{ID: 47, Name: "trunc", Params: []string{"number"}, Fn: rounding(math.Trunc)},
+		floatFunction(48, "sin", math.Sin),
+		floatFunction(49, "cos", math.Cos),
+		floatFunction(50, "tan", math.Tan),
+		floatFunction(51, "asin", math.Asin),
+		floatFunction(52, "acos", math.Acos),
+		floatFunction(53, "atan", math.Atan),
+		floatFunction(54, "sinh", math.Sinh),
+		floatFunction(55, "cosh", math.Cosh),
+		floatFunction(56, "tanh", math.Tanh),
+		floatFunction(57, "exp", math.Exp),
+		floatFunction(58, "log", math.Log),
+		floatFunction(59, "log2", math.Log2),
+		floatFunction(60, "log10", math.Log10),
+		&Builtin{ID: 61, Name: "hypot", Params: []string{"number", "number"}, Return: "float",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return &Float{Value: math.Hypot(number(args[0]), number(args[1]))}
+			}},
+		// mod and div round the quotient toward negative infinity, so the result
+		// of mod has the sign of the divisor: mod(-7, 3) is 2 and div(-7, 3) is -3
+		integerDivision(62, "mod", func(a, b int64) (int64, bool) {
+			m := a % b
+			if m != 0 && (m < 0) != (b < 0) {
+				m += b
+			}
+			return m, false
+		}),
+		// the smallest int divided by -1 wraps around to itself
+		integerDivision(63, "div", func(a, b int64) (int64, bool) {
+			q := a / b
+			if a%b != 0 && (a < 0) != (b < 0) {
+				q--
+			}
+			return q, a == math.MinInt64 && b == -1
+		}),
+		&Builtin{ID: 64, Name: "is_nan", Params: []string{"number"}, Return: "bool",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return &Boolean{Value: math.IsNaN(number(args[0]))}
+			}},
+		&Builtin{ID: 65, Name: "is_inf", Params: []string{"number"}, Return: "bool",
+			Fn: func(rt *Runtime, args ...Object) Object {
+				return &Boolean{Value: math.IsInf(number(args[0]), 0)}
+			}},
+	)
+}
+
+// floatFunction returns a builtin applying fn to its only argument.
+func floatFunction(id int, name string, fn func(float64) float64) *Builtin {
+	return &Builtin{ID: id, Name: name, Params: []string{"number"}, Return: "float",
+		Fn: func(rt *Runtime, args ...Object) Object {
+			return &Float{Value: fn(number(args[0]))}
+		}}
+}
+
+// rounding returns a builtin function rounding a float with fn. Integers are
+// already rounded and are returned as they are.
+func rounding(fn func(float64) float64) BuiltinFunction {
+	return func(rt *Runtime, args ...Object) Object {
+		if arg, ok := args[0].(*Float); ok {
+			return &Float{Value: fn(arg.Value)}
+		}
+		return args[0]
+	}
+}
+
+// extremum returns a builtin function picking the argument which compares to
+// every other one as sign, -1 for the smallest and 1 for the largest. The
+// result is an Integer only when all the arguments are.
+func extremum(sign int) BuiltinFunction {
+	return func(rt *Runtime, args ...Object) Object {
+		best, integral := 0, true
+		for i, arg := range args {
+			integral = integral && arg.Type() == INTEGER_OBJ
+
+			if compareNumbers(arg, args[best]) == sign {
+				best = i
+			}
+		}
+
+		if integral {
+			return args[best]
+		}
+		return &Float{Value: number(args[best])}
+	}
+}
+
+// compareNumbers returns -1, 0 or 1 as a is less than, equal to or greater
+// than b. Two Integers are compared as they are, since converting them to
+// floats loses the precision of the ones beyond 2^53. NaN compares equal to
+// any number.
+func compareNumbers(a, b Object) int {
+	if a, ok := a.(*Integer); ok {
+		if b, ok := b.(*Integer); ok {
+			switch {
+			case a.Value < b.Value:
+				return -1
+			case a.Value > b.Value:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	x, y := number(a), number(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// integerDivision returns a builtin applying fn to two INTEGERs, the second
+// one being non-zero. fn also reports whether the result overflowed, which is
+// an error in checked arithmetic mode.
+func integerDivision(id int, name string, fn func(a, b int64) (int64, bool)) *Builtin {
+	return &Builtin{ID: id, Name: name, Params: []string{"int", "int"}, Return: "int",
+		Fn: func(rt *Runtime, args ...Object) Object {
+			a, b := args[0].(*Integer), args[1].(*Integer)
+			if b.Value == 0 {
+				return newError("division by zero")
+			}
+
+			result, overflow := fn(a.Value, b.Value)
+			if overflow && rt.CheckedArithmetic() {
+				return newError("integer overflow: %s(%d, %d)", name, a.Value, b.Value)
+			}
+			return &Integer{Value: result}
+		}}
+}
@@ -3,13 +3,16 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/odas0r/yail/ast"
 	"github.com/odas0r/yail/code"
 )
 
-type BuiltinFunction func(args ...Object) Object
+type BuiltinFunction func(rt *Runtime, args ...Object) Object
 
 type ObjectType string
 
@@ -28,10 +31,15 @@ const (
 	BUILTIN_OBJ  = "BUILTIN"
 
 	ARRAY_OBJ = "ARRAY"
+	MAP_OBJ   = "MAP"
 
-	STRUCT_OBJ = "STRUCT"
+	STRUCT_OBJ      = "STRUCT"
+	STRUCT_TYPE_OBJ = "STRUCT_TYPE"
 
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
+
+	JUMP_TABLE_OBJ = "JUMP_TABLE"
+	ITERATOR_OBJ   = "ITERATOR"
 )
 
 type Object interface {
@@ -39,19 +47,42 @@ type Object interface {
 	Inspect() string
 }
 
+// Hashable is implemented by the objects that can be used as map keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+// HashKey identifies a map key by its type and its value, the string itself
+// for strings, so that two different keys never share an entry.
+type HashKey struct {
+	Type   ObjectType
+	Value  uint64
+	String string
+}
+
 type Integer struct {
 	Value int64
 }
 
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
 
 type Float struct {
 	Value float64
 }
 
 func (i *Float) Type() ObjectType { return FLOAT_OBJ }
-func (i *Float) Inspect() string  { return fmt.Sprintf("%f", i.Value) }
+func (i *Float) Inspect() string {
+	// always keep a decimal point, so that 1.0 isn't printed as the integer 1
+	out := strconv.FormatFloat(i.Value, 'f', -1, 64)
+	if !strings.ContainsAny(out, ".NI") {
+		out += ".0"
+	}
+	return out
+}
 
 type Boolean struct {
 	Value bool
@@ -59,6 +90,13 @@ type Boolean struct {
 
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
 
 type Null struct{}
 
@@ -110,9 +148,20 @@ type String struct {
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: s.Type(), String: s.Value}
+}
 
+// Builtin is a function provided by the host. Its ID is the operand of
+// OpGetBuiltin, its parameters and return type are written as the type checker
+// writes types (see Registry), "" standing for a type only known at run time.
 type Builtin struct {
-	Fn BuiltinFunction
+	ID       int
+	Name     string
+	Params   []string
+	Variadic bool
+	Return   string
+	Fn       BuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -138,7 +187,195 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+type MapPair struct {
+	Key   Object
+	Value Object
+}
+
+// Map is a collection of key-value pairs, kept in insertion order so that
+// iterating a map is deterministic.
+type Map struct {
+	Pairs map[HashKey]MapPair
+	Keys  []HashKey
+}
+
+func NewMap() *Map {
+	return &Map{Pairs: map[HashKey]MapPair{}}
+}
+
+func (m *Map) Type() ObjectType { return MAP_OBJ }
+func (m *Map) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range m.Entries() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (m *Map) Get(key Hashable) (Object, bool) {
+	pair, ok := m.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+func (m *Map) Set(key Hashable, value Object) {
+	hash := key.HashKey()
+	if _, ok := m.Pairs[hash]; !ok {
+		m.Keys = append(m.Keys, hash)
+	}
+	m.Pairs[hash] = MapPair{Key: key.(Object), Value: value}
+}
+
+func (m *Map) Delete(key Hashable) {
+	hash := key.HashKey()
+	if _, ok := m.Pairs[hash]; !ok {
+		return
+	}
+
+	delete(m.Pairs, hash)
+	for i, k := range m.Keys {
+		if k == hash {
+			m.Keys = append(m.Keys[:i], m.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Entries returns the pairs of the map in insertion order.
+func (m *Map) Entries() []MapPair {
+	entries := make([]MapPair, len(m.Keys))
+	for i, k := range m.Keys {
+		entries[i] = m.Pairs[k]
+	}
+	return entries
+}
+
+// Iterator walks the elements of an array, the runes of a string or the pairs
+// of a map in place, without copying them.
+type Iterator struct {
+	next    func() (key, value Object, ok bool)
+	overMap bool
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// NewIterator returns an iterator over obj, ok is false if obj can't be
+// iterated.
+func NewIterator(obj Object) (it *Iterator, ok bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		i := 0
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= len(obj.Elements) {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: int64(i - 1)}, obj.Elements[i-1], true
+		}}, true
+	case *String:
+		offset, i := 0, 0
+		return &Iterator{next: func() (Object, Object, bool) {
+			if offset >= len(obj.Value) {
+				return nil, nil, false
+			}
+			r, size := utf8.DecodeRuneInString(obj.Value[offset:])
+			offset += size
+			i++
+			return &Integer{Value: int64(i - 1)}, &String{Value: string(r)}, true
+		}}, true
+	case *Map:
+		// pairs added while iterating are not visited, deleted ones are skipped
+		keys := append([]HashKey{}, obj.Keys...)
+		i := 0
+		return &Iterator{overMap: true, next: func() (Object, Object, bool) {
+			for i < len(keys) {
+				pair, ok := obj.Pairs[keys[i]]
+				i++
+				if ok {
+					return pair.Key, pair.Value, true
+				}
+			}
+			return nil, nil, false
+		}}, true
+	default:
+		return nil, false
+	}
+}
+
+// Next returns the key and the value of the next element: its position for an
+// array or a string, its key for a map. ok is false once all the elements were
+// visited.
+func (it *Iterator) Next() (key, value Object, ok bool) {
+	return it.next()
+}
+
+// Single returns the element visited by a loop with a single variable: the
+// key of a map, and the value of an array or a string.
+func (it *Iterator) Single(key, value Object) Object {
+	if it.overMap {
+		return key
+	}
+	return value
+}
+
+// StructField is a field of a struct type, Default is the value it holds in a
+// new instance of the struct.
+type StructField struct {
+	Name    string
+	Type    string // canonical type name, e.g. "float" or "int[]"
+	Default Object
+}
+
+// StructType is a struct declared in a structs block, e.g.
+// `point2D { float x, y; }`. Its fields are kept in declaration order.
+type StructType struct {
+	Name   string
+	Fields []StructField
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string  { return "struct " + st.Name }
+
+// Field returns the field with the given name.
+func (st *StructType) Field(name string) (StructField, bool) {
+	for _, f := range st.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return StructField{}, false
+}
+
+// New returns a new instance of the struct, with every field set to a copy of
+// its default value.
+func (st *StructType) New() *Struct {
+	attributes := make(map[string]Object, len(st.Fields))
+	for _, f := range st.Fields {
+		attributes[f.Name] = CopyValue(f.Default)
+	}
+
+	return &Struct{StructType: st, Attributes: attributes}
+}
+
+// Size returns the number of values held by a new instance of the struct
+// type, see Size.
+func (st *StructType) Size() int64 {
+	n := int64(len(st.Fields))
+	for _, f := range st.Fields {
+		n += Size(f.Default)
+	}
+	return n
+}
+
 type Struct struct {
+	StructType *StructType
 	Attributes map[string]Object
 }
 
@@ -147,24 +384,103 @@ func (s *Struct) Inspect() string {
 	var out bytes.Buffer
 
 	entries := []string{}
-	for k, v := range s.Attributes {
-		entries = append(entries, k+": "+v.Inspect())
+	for _, name := range s.FieldNames() {
+		entries = append(entries, name+": "+s.Attributes[name].Inspect())
 	}
 
-	out.WriteString("struct {")
-	if len(entries) > 0 {
-		out.WriteString(" ")
+	if s.StructType != nil {
+		out.WriteString(s.StructType.Name + " ")
 	}
-	out.WriteString(strings.Join(entries, "; "))
+
+	out.WriteString("{")
 	if len(entries) > 0 {
-		out.WriteString(";")
+		out.WriteString(" ")
+		out.WriteString(strings.Join(entries, "; "))
+		out.WriteString(" ")
 	}
-	out.WriteString(" }")
+	out.WriteString("}")
 
 	return out.String()
 }
 
+// FieldNames returns the names of the fields of the struct in declaration
+// order.
+func (s *Struct) FieldNames() []string {
+	names := make([]string, 0, len(s.Attributes))
+
+	if s.StructType != nil {
+		for _, f := range s.StructType.Fields {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	for name := range s.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Copy returns a deep copy of the struct. Structs are values: assigning one or
+// passing it to a function must never share its fields with the original.
+func (s *Struct) Copy() *Struct {
+	attributes := make(map[string]Object, len(s.Attributes))
+	for name, value := range s.Attributes {
+		attributes[name] = CopyValue(value)
+	}
+
+	return &Struct{StructType: s.StructType, Attributes: attributes}
+}
+
+// CopyValue copies the structs, arrays and maps held by a struct field, any
+// other object is immutable and is returned as is.
+func CopyValue(obj Object) Object {
+	switch obj := obj.(type) {
+	case *Struct:
+		return obj.Copy()
+	case *Array:
+		elements := make([]Object, len(obj.Elements))
+		for i, e := range obj.Elements {
+			elements[i] = CopyValue(e)
+		}
+		return &Array{Elements: elements}
+	case *Map:
+		m := NewMap()
+		for _, pair := range obj.Entries() {
+			m.Set(pair.Key.(Hashable), CopyValue(pair.Value))
+		}
+		return m
+	default:
+		return obj
+	}
+}
+
+// Size returns the number of values held by obj, counting the ones held by
+// the structs, arrays and maps it holds, i.e. the number of values allocated
+// by CopyValue.
+func Size(obj Object) int64 {
+	var n int64
+	switch obj := obj.(type) {
+	case *Struct:
+		for _, value := range obj.Attributes {
+			n += 1 + Size(value)
+		}
+	case *Array:
+		for _, e := range obj.Elements {
+			n += 1 + Size(e)
+		}
+	case *Map:
+		for _, pair := range obj.Entries() {
+			n += 2 + Size(pair.Value)
+		}
+	}
+	return n
+}
+
 type CompiledFunction struct {
+	Name          string // empty for the main program
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
@@ -174,3 +490,33 @@ func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
 func (cf *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
+
+// JumpTable holds the positions of the cases of a switch statement over dense
+// integer values: the case of value v starts at Targets[v-Min], and values
+// without a case jump to Default.
+type JumpTable struct {
+	Min     int64
+	Targets []int
+	Default int
+}
+
+func (jt *JumpTable) Type() ObjectType { return JUMP_TABLE_OBJ }
+func (jt *JumpTable) Inspect() string {
+	return fmt.Sprintf("JumpTable[%d..%d]", jt.Min, jt.Min+int64(len(jt.Targets))-1)
+}
+
+// Lookup returns the position to jump to for the given switch value.
+func (jt *JumpTable) Lookup(value Object) int {
+	integer, ok := value.(*Integer)
+	if !ok {
+		return jt.Default
+	}
+
+	// a value below Min wraps around to a large index
+	i := uint64(integer.Value) - uint64(jt.Min)
+	if i >= uint64(len(jt.Targets)) {
+		return jt.Default
+	}
+
+	return jt.Targets[i]
+}
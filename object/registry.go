@@ -0,0 +1,231 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The parameters of a builtin are described with the type names of the type
+// checker: "int", "float", "bool", "string", "int[]", ... and a few wider
+// types: "number" (an int or a float), "array", "map", "struct" and "any".
+// Alternatives are separated by "|", e.g. "array|struct", and a trailing "?"
+// marks an optional parameter, e.g. "int?".
+
+// Registry holds builtins by name and by ID. IDs are chosen by the builtins
+// themselves and are what the bytecode refers to, so that the order in which
+// builtins are registered doesn't matter.
+type Registry struct {
+	byName map[string]*Builtin
+	byID   map[int]*Builtin
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: map[string]*Builtin{}, byID: map[int]*Builtin{}}
+}
+
+// Builtins is the registry of the builtins of the language.
+var Builtins = NewRegistry()
+
+// FirstHostID is the first builtin ID left to the functions of host
+// applications, the IDs below it being reserved for the language.
+const FirstHostID = 1024
+
+// Register adds a builtin, whose name and ID must not be taken yet.
+func (r *Registry) Register(b *Builtin) error {
+	if _, ok := r.byName[b.Name]; ok {
+		return fmt.Errorf("builtin %s already registered", b.Name)
+	}
+	if other, ok := r.byID[b.ID]; ok {
+		return fmt.Errorf("builtin ID %d of %s already used by %s", b.ID, b.Name, other.Name)
+	}
+
+	r.byName[b.Name] = b
+	r.byID[b.ID] = b
+	return nil
+}
+
+// mustRegister registers the builtins of the language, a conflict between
+// them being a bug.
+func (r *Registry) mustRegister(builtins ...*Builtin) {
+	for _, b := range builtins {
+		if err := r.Register(b); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Lookup returns the builtin with the given name.
+func (r *Registry) Lookup(name string) (*Builtin, bool) {
+	b, ok := r.byName[name]
+	return b, ok
+}
+
+// Get returns the builtin with the given ID.
+func (r *Registry) Get(id int) (*Builtin, bool) {
+	b, ok := r.byID[id]
+	return b, ok
+}
+
+// All returns the registered builtins ordered by ID.
+func (r *Registry) All() []*Builtin {
+	all := make([]*Builtin, 0, len(r.byID))
+	for _, b := range r.byID {
+		all = append(all, b)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
+}
+
+// Copy returns a new registry holding the same builtins, to which other
+// builtins can be added without changing r.
+func (r *Registry) Copy() *Registry {
+	c := NewRegistry()
+	for _, b := range r.byID {
+		c.byName[b.Name] = b
+		c.byID[b.ID] = b
+	}
+	return c
+}
+
+// Arity returns the minimum number of arguments of a builtin, and the maximum
+// one, -1 if it is variadic.
+func (b *Builtin) Arity() (min, max int) {
+	for _, param := range b.Params {
+		if !strings.HasSuffix(param, "?") {
+			min++
+		}
+	}
+	if b.Variadic {
+		return min, -1
+	}
+	return min, len(b.Params)
+}
+
+// Param returns the type of the parameter given the i-th argument, the last
+// parameter of a variadic builtin receiving all the extra arguments.
+func (b *Builtin) Param(i int) string {
+	if i >= len(b.Params) {
+		i = len(b.Params) - 1
+	}
+	return strings.TrimSuffix(b.Params[i], "?")
+}
+
+// Call validates the arguments against the parameters of the builtin, then
+// calls it.
+func (b *Builtin) Call(rt *Runtime, args ...Object) Object {
+	if err := b.checkArgs(args); err != nil {
+		return err
+	}
+	return b.Fn(rt, args...)
+}
+
+func (b *Builtin) checkArgs(args []Object) *Error {
+	if err := b.CheckArgCount(len(args)); err != nil {
+		return newError("%s", err)
+	}
+
+	for i, arg := range args {
+		param := b.Param(i)
+		if !matches(param, arg) {
+			return newError("argument %d to '%s' must be %s, got %s", i+1, b.Name, param, TypeName(arg))
+		}
+	}
+
+	return nil
+}
+
+// CheckArgCount fails when a builtin can't be called with n arguments.
+func (b *Builtin) CheckArgCount(n int) error {
+	min, max := b.Arity()
+	switch {
+	case max == -1 && n < min:
+		return fmt.Errorf("wrong number of arguments for '%s'. got=%d, want at least %d", b.Name, n, min)
+	case max != -1 && (n < min || n > max) && min == max:
+		return fmt.Errorf("wrong number of arguments for '%s'. got=%d, want=%d", b.Name, n, min)
+	case max != -1 && (n < min || n > max):
+		return fmt.Errorf("wrong number of arguments for '%s'. got=%d, want %d to %d", b.Name, n, min, max)
+	}
+	return nil
+}
+
+// matches reports whether obj is a value of the parameter type param.
+func matches(param string, obj Object) bool {
+	for _, alt := range strings.Split(param, "|") {
+		switch alt {
+		case "any":
+			return true
+		case "number":
+			if obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ {
+				return true
+			}
+		case "array":
+			if obj.Type() == ARRAY_OBJ {
+				return true
+			}
+		case "map":
+			if obj.Type() == MAP_OBJ {
+				return true
+			}
+		case "struct":
+			if obj.Type() == STRUCT_OBJ {
+				return true
+			}
+		default:
+			if elem := strings.TrimSuffix(alt, "[]"); elem != alt {
+				if arr, ok := obj.(*Array); ok && allMatch(elem, arr.Elements) {
+					return true
+				}
+			} else if TypeName(obj) == alt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func allMatch(param string, objs []Object) bool {
+	for _, obj := range objs {
+		if !matches(param, obj) {
+			return false
+		}
+	}
+	return true
+}
+
+// TypeName returns the name of the type of a value, as the type checker
+// would write it: "int", "string[]", "point", ... An array whose elements
+// don't share a type is an "array".
+func TypeName(obj Object) string {
+	switch obj := obj.(type) {
+	case *Integer:
+		return "int"
+	case *Float:
+		return "float"
+	case *Boolean:
+		return "bool"
+	case *String:
+		return "string"
+	case *Map:
+		return "map"
+	case *Struct:
+		return obj.StructType.Name
+	case *Null:
+		return "null"
+	case *Builtin, *CompiledFunction:
+		return "function"
+	case *Array:
+		if len(obj.Elements) == 0 {
+			return "array"
+		}
+		elem := TypeName(obj.Elements[0])
+		for _, e := range obj.Elements[1:] {
+			if TypeName(e) != elem {
+				return "array"
+			}
+		}
+		return elem + "[]"
+	default:
+		return strings.ToLower(string(obj.Type()))
+	}
+}
@@ -0,0 +1,96 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Runtime is the state owned by the VM running a program, which builtins
+// receive when they are called. Keeping it out of package variables lets
+// several VMs run in the same process without interfering.
+type Runtime struct {
+	Rand *rand.Rand
+
+	// In and Out are the input and output of the program, e.g. for read and
+	// write. In is shared by all the reads, so that no buffered input is lost
+	// between two calls.
+	In  *bufio.Reader
+	Out io.Writer
+
+	// allocated counts the values allocated by the program, which may not
+	// exceed maxAllocations unless it is 0
+	allocated      int64
+	maxAllocations int64
+
+	// checkedArith makes integer operations fail on overflow instead of
+	// wrapping around, in the builtins as in the operators
+	checkedArith bool
+}
+
+// NewRuntime returns a runtime reading from the standard input and writing to
+// the standard output, whose random number generator is seeded with the
+// current time.
+func NewRuntime() *Runtime {
+	return &Runtime{
+		Rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+		In:   bufio.NewReader(os.Stdin),
+		Out:  os.Stdout,
+	}
+}
+
+// SetIO makes the program read from in and write to out. A *bufio.Reader is
+// used as it is, so that the input it already buffered isn't lost.
+func (rt *Runtime) SetIO(in io.Reader, out io.Writer) {
+	if reader, ok := in.(*bufio.Reader); ok {
+		rt.In = reader
+	} else {
+		rt.In = bufio.NewReader(in)
+	}
+	rt.Out = out
+}
+
+// SetAllocationLimit bounds the number of values the program may allocate,
+// 0 meaning no limit.
+func (rt *Runtime) SetAllocationLimit(n int64) {
+	rt.maxAllocations = n
+}
+
+// Allocate accounts for n values about to be allocated by the program, e.g.
+// the elements of a new array or the bytes of a new string. It returns false,
+// and the values must not be allocated, once the limit is exceeded or when n
+// is negative.
+func (rt *Runtime) Allocate(n int64) bool {
+	if n < 0 {
+		return false
+	}
+
+	// the count stops at the largest int instead of wrapping around, which
+	// would let the program allocate past its limit
+	if n > math.MaxInt64-rt.allocated {
+		rt.allocated = math.MaxInt64
+	} else {
+		rt.allocated += n
+	}
+	return !rt.OverAllocationLimit()
+}
+
+// OverAllocationLimit reports whether the program allocated more values than
+// its limit.
+func (rt *Runtime) OverAllocationLimit() bool {
+	return rt.maxAllocations > 0 && rt.allocated > rt.maxAllocations
+}
+
+// SetCheckedArithmetic enables or disables the checked arithmetic mode, in
+// which a signed integer overflow is an error instead of wrapping around.
+func (rt *Runtime) SetCheckedArithmetic(enabled bool) {
+	rt.checkedArith = enabled
+}
+
+// CheckedArithmetic reports whether the checked arithmetic mode is enabled.
+func (rt *Runtime) CheckedArithmetic() bool {
+	return rt.checkedArith
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/odas0r/yail/ast"
 	"github.com/odas0r/yail/lexer"
@@ -21,6 +22,7 @@ const (
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POWER       // x ** y, binds tighter than a prefix: -x ** 2 is -(x ** 2)
 	CALL        // myFunction(X)
 	INDEX       // array[index]
 	ACCESSOR    // a.b
@@ -37,10 +39,20 @@ var precedences = map[token.TokenType]int{
 	token.AND: LESSGREATER, // and
 	token.OR:  LESSGREATER, // or
 
-	token.PLUS:     SUM,      // +
-	token.MINUS:    SUM,      // -
-	token.SLASH:    PRODUCT,  // /
-	token.ASTERISK: PRODUCT,  // *
+	token.PLUS:     SUM,     // +
+	token.MINUS:    SUM,     // -
+	token.PIPE:     SUM,     // |
+	token.CARET:    SUM,     // ^
+	token.SLASH:    PRODUCT, // /
+	token.ASTERISK: PRODUCT, // *
+
+	token.PERCENT:     PRODUCT, // %
+	token.FLOOR_DIV:   PRODUCT, // //
+	token.AMPERSAND:   PRODUCT, // &
+	token.SHIFT_LEFT:  PRODUCT, // <<
+	token.SHIFT_RIGHT: PRODUCT, // >>
+	token.POWER:       POWER,   // **
+
 	token.LPAREN:   CALL,     // myFunction(X)
 	token.LBRACKET: INDEX,    // array[index]
 	token.ACCESSOR: ACCESSOR, // a.b
@@ -75,16 +87,26 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.LBRACE, p.parseArrayLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.FLOOR_DIV, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
@@ -137,6 +159,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		} else if p.peekTokenIs(token.IDENT) || p.peekTokenIs(token.ASSIGN) { // VARIABLE
 			return p.parseVariableStatement()
 		}
+	case token.FUNC: // VARIABLE of a function type
+		return p.parseVariableStatement()
+	case token.MAP: // VARIABLE of a map type
+		return p.parseVariableStatement()
 	case token.GLOBAL:
 		return p.parseGlobalStatement()
 	case token.CONST:
@@ -147,6 +173,14 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseWhileStatement()
 	case token.FOR:
 		return p.parseForStatement()
+	case token.RETURN:
+		return p.parseReturnStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.SWITCH:
+		return p.parseSwitchStatement()
 	}
 
 	targetExpression := p.parseExpression(LOWEST)
@@ -260,13 +294,21 @@ func (p *Parser) parseVariableStatement() ast.Statement {
 }
 
 func (p *Parser) parseArrayStatement(curToken token.Token, curType *ast.Identifier, name *ast.Identifier) ast.Statement {
-	arrLen := p.parseArraySize()
+	arrLen, dims := p.parseArraySize()
+	dynamic := arrLen == nil
+
+	// an array declared without a size nor elements holds a single element
+	if arrLen == nil && p.peekTokenIs(token.SEMICOLON) {
+		arrLen = &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+	}
 
 	arrStmt := &ast.ArrayStatement{
-		Token: curToken,
-		Name:  name,
-		Size:  arrLen,
-		Type:  curType,
+		Token:      curToken,
+		Name:       name,
+		Size:       arrLen,
+		Dimensions: dims,
+		Type:       curType,
+		Dynamic:    dynamic,
 	}
 
 	if !p.peekTokenIs(token.ASSIGN) {
@@ -274,7 +316,7 @@ func (p *Parser) parseArrayStatement(curToken token.Token, curType *ast.Identifi
 		if ok {
 			values := make([]ast.Expression, sizeLiteral.Value)
 			for i := 0; i < int(sizeLiteral.Value); i++ {
-				values[i] = p.defaultValueForType(arrStmt.Token)
+				values[i] = p.defaultArrayElement(arrStmt.Token, curType, dims)
 			}
 
 			arrStmt.Elements = values
@@ -282,6 +324,18 @@ func (p *Parser) parseArrayStatement(curToken token.Token, curType *ast.Identifi
 	} else {
 		p.nextToken()
 
+		// an array initialized by an expression, e.g. `int b[] = reverse(a);`
+		if !p.peekTokenIs(token.LBRACE) {
+			p.nextToken()
+			arrStmt.Value = p.parseExpression(LOWEST)
+
+			if p.peekTokenIs(token.SEMICOLON) {
+				p.nextToken()
+			}
+
+			return arrStmt
+		}
+
 		// Expect the '{' token
 		if !p.expectPeek(token.LBRACE) {
 			return nil
@@ -290,11 +344,22 @@ func (p *Parser) parseArrayStatement(curToken token.Token, curType *ast.Identifi
 		if p.peekTokenIs(token.RBRACE) {
 			p.nextToken()
 
-			arrStmt.Size = &ast.IntegerLiteral{
-				Token: token.Token{Type: token.INT, Literal: "1"},
-				Value: 1,
+			// `int v[5] = {};` holds five default values, `int v[] = {};` is
+			// empty
+			n := int64(0)
+			if sizeLiteral, ok := arrStmt.Size.(*ast.IntegerLiteral); ok {
+				n = sizeLiteral.Value
+			} else {
+				arrStmt.Size = &ast.IntegerLiteral{
+					Token: token.Token{Type: token.INT, Literal: "0"},
+					Value: 0,
+				}
+			}
+
+			arrStmt.Elements = make([]ast.Expression, n)
+			for i := range arrStmt.Elements {
+				arrStmt.Elements[i] = p.defaultArrayElement(arrStmt.Token, curType, dims)
 			}
-			arrStmt.Elements = []ast.Expression{p.defaultValueForType(arrStmt.Token)}
 
 			if p.peekTokenIs(token.SEMICOLON) {
 				p.nextToken()
@@ -308,9 +373,11 @@ func (p *Parser) parseArrayStatement(curToken token.Token, curType *ast.Identifi
 		arrStmt.Elements = p.parseArrayElements()
 
 		// Set the size if it wasn't set before
-		arrStmt.Size = &ast.IntegerLiteral{
-			Token: token.Token{Type: token.INT, Literal: strconv.Itoa(len(arrStmt.Elements))},
-			Value: int64(len(arrStmt.Elements)),
+		if arrStmt.Size == nil {
+			arrStmt.Size = &ast.IntegerLiteral{
+				Token: token.Token{Type: token.INT, Literal: strconv.Itoa(len(arrStmt.Elements))},
+				Value: int64(len(arrStmt.Elements)),
+			}
 		}
 
 		// Expect the '}' token
@@ -355,9 +422,23 @@ func (p *Parser) parseVariableAssignStatment() ast.Statement {
 			}
 		}
 
+		braceToken := p.curToken
 		p.nextToken()
 
-		values := p.parseArrayElements()
+		first := p.parseExpression(LOWEST)
+
+		// assigning a map literal, e.g. `m = {"a": 1};`
+		if p.peekTokenIs(token.COLON) {
+			value := p.parseMapLiteral(braceToken, first)
+
+			if p.peekTokenIs(token.SEMICOLON) {
+				p.nextToken()
+			}
+
+			return &ast.AssignmentStatement{Token: firstToken, Left: name, Value: value}
+		}
+
+		values := p.parseRemainingElements(first)
 
 		if !p.expectPeek(token.RBRACE) {
 			return nil
@@ -395,9 +476,12 @@ func (p *Parser) parseVariableAssignStatment() ast.Statement {
 	}
 }
 
-func (p *Parser) parseArraySize() ast.Expression {
+// parseArraySize parses the size of an array declaration and the sizes of its
+// inner dimensions, e.g. `[2][3]` in `float m[2][3];`. The size is nil when
+// it is not given.
+func (p *Parser) parseArraySize() (ast.Expression, []ast.Expression) {
 	if !p.expectPeek(token.LBRACKET) {
-		return nil
+		return nil, nil
 	}
 
 	var size ast.Expression
@@ -409,21 +493,130 @@ func (p *Parser) parseArraySize() ast.Expression {
 
 	p.nextToken()
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	return size, p.parseArrayDimensions()
+}
+
+// parseArrayDimensions parses the inner dimensions following the first one of
+// an array, a dimension without a size is nil, e.g. `[][3]` gives [nil, 3].
+func (p *Parser) parseArrayDimensions() []ast.Expression {
+	var dims []ast.Expression
+
+	for p.peekTokenIs(token.LBRACKET) {
+		p.nextToken()
+
+		if p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			dims = append(dims, nil)
+			continue
+		}
+
+		p.nextToken()
+		dims = append(dims, p.parseExpression(LOWEST))
+
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+	}
+
+	return dims
+}
+
+// parseArrayLiteral parses an array literal used as an expression, e.g. the
+// rows of `int m[2][2] = {{1, 2}, {3, 4}};`, or a map literal when its first
+// element is followed by a colon, e.g. `{"a": 1, "b": 2}`.
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	arr := &ast.ArrayStatement{Token: p.curToken, Elements: []ast.Expression{}}
+
+	p.nextToken()
+
+	if !p.curTokenIs(token.RBRACE) {
+		first := p.parseExpression(LOWEST)
+		if p.peekTokenIs(token.COLON) {
+			return p.parseMapLiteral(arr.Token, first)
+		}
+
+		arr.Elements = p.parseRemainingElements(first)
+
+		if !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+	}
+
+	arr.Size = &ast.IntegerLiteral{
+		Token: token.Token{Type: token.INT, Literal: strconv.Itoa(len(arr.Elements))},
+		Value: int64(len(arr.Elements)),
+	}
+
+	return arr
+}
+
+// parseMapLiteral parses the pairs of a map literal, the current token being
+// its first key.
+func (p *Parser) parseMapLiteral(tok token.Token, firstKey ast.Expression) ast.Expression {
+	lit := &ast.MapLiteral{Token: tok}
+	key := firstKey
+
+	for {
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+
+		lit.Keys = append(lit.Keys, key)
+		lit.Values = append(lit.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
+		p.nextToken()
+		key = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return lit
+}
+
+// defaultArrayElement returns the default value of an element of an array
+// with the given inner dimensions: a value of its type for a one-dimensional
+// array, and a default filled row otherwise.
+func (p *Parser) defaultArrayElement(t token.Token, typ *ast.Identifier, dims []ast.Expression) ast.Expression {
+	if len(dims) == 0 {
+		return p.defaultValueForType(t)
+	}
+
+	// a row without a size holds a single element, like `int a[];`
+	size, ok := dims[0].(*ast.IntegerLiteral)
+	if !ok {
 		size = &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
 	}
 
-	return size
+	row := &ast.ArrayStatement{Token: t, Type: typ, Size: size, Dimensions: dims[1:]}
+
+	row.Elements = make([]ast.Expression, size.Value)
+	for i := range row.Elements {
+		row.Elements[i] = p.defaultArrayElement(t, typ, dims[1:])
+	}
+
+	return row
 }
 
 func (p *Parser) parseArrayElements() []ast.Expression {
-	expressions := []ast.Expression{}
-
 	if p.curTokenIs(token.RBRACE) {
-		return expressions
+		return []ast.Expression{}
 	}
 
-	expressions = append(expressions, p.parseExpression(LOWEST))
+	return p.parseRemainingElements(p.parseExpression(LOWEST))
+}
+
+// parseRemainingElements parses the elements of an array literal following
+// the first one.
+func (p *Parser) parseRemainingElements(first ast.Expression) []ast.Expression {
+	expressions := []ast.Expression{first}
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
@@ -530,7 +723,7 @@ func (p *Parser) parseStructAttributes() []*ast.Attribute {
 			Token: p.curToken,
 		}
 
-		if !p.peekTokenIs(token.IDENT) {
+		if !p.curTokenIs(token.MAP) && !p.peekTokenIs(token.IDENT) {
 			attr.Type = topAttr.Type // set type top attribute type
 			attr.Value = p.defaultValueForType(topAttr.Type.Token)
 			attr.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
@@ -627,10 +820,49 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{
+	ident := &ast.Identifier{
 		Token: p.curToken,
 		Value: p.curToken.Literal,
 	}
+
+	if p.peekTokenIs(token.LBRACE) {
+		return p.parseStructLiteral(ident)
+	}
+
+	return ident
+}
+
+// parseStructLiteral parses a struct literal such as `point2D{ x = 1.0, y = 2.0 }`,
+// the fields that are not set keep their default value.
+func (p *Parser) parseStructLiteral(name *ast.Identifier) ast.Expression {
+	lit := &ast.StructLiteral{Token: p.curToken, Name: name}
+
+	p.nextToken()
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		lit.Fields = append(lit.Fields, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.expectPeek(token.ASSIGN) {
+			return nil
+		}
+		p.nextToken()
+
+		lit.Values = append(lit.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return lit
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
@@ -684,6 +916,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	// ** is right associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+	if p.curTokenIs(token.POWER) {
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
@@ -732,6 +968,22 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
+		// `else if` is an else block holding only the nested if expression
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+
+			block := &ast.BlockStatement{Token: p.curToken}
+			stmt := &ast.ExpressionStatement{Token: p.curToken}
+			stmt.Expression = p.parseIfExpression()
+			if stmt.Expression == nil {
+				return nil
+			}
+			block.Statements = []ast.Statement{stmt}
+
+			expression.Alternative = block
+			return expression
+		}
+
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
@@ -825,7 +1077,9 @@ func (p *Parser) parseFunctionStatement() ast.Statement {
 
 	fuc.Parameters = p.parseFunctionParameters()
 
-	if !p.expectPeek(token.IDENT) {
+	if p.peekTokenIs(token.FUNC) || p.peekTokenIs(token.MAP) {
+		p.nextToken()
+	} else if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 
@@ -873,6 +1127,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Parameter {
 				return nil
 			}
 		}
+		topParam.Dimensions = p.parseArrayDimensions()
 		topParam.IsArray = true
 	}
 
@@ -886,7 +1141,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Parameter {
 			Token: p.curToken,
 		}
 
-		if !p.peekTokenIs(token.IDENT) {
+		if !p.curTokenIs(token.FUNC) && !p.curTokenIs(token.MAP) && !p.peekTokenIs(token.IDENT) {
 			param.Type = topParam.Type // set the top attribute type as default
 			param.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		} else {
@@ -914,6 +1169,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Parameter {
 				}
 			}
 
+			param.Dimensions = p.parseArrayDimensions()
 			param.IsArray = true
 		}
 
@@ -946,6 +1202,7 @@ func (p *Parser) parseFunctionReturnType() *ast.ReturnType {
 				return nil
 			}
 		}
+		returnType.Dimensions = p.parseArrayDimensions()
 		returnType.IsArray = true
 	}
 
@@ -1033,8 +1290,36 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
 	p.nextToken()
+
+	// a slice without a lower bound, e.g. `s[:2]`
+	if p.curTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, nil)
+	}
+
 	exp.Index = p.parseExpression(LOWEST)
 
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseSliceExpression parses the upper bound of a slice, the current token
+// being its colon.
+func (p *Parser) parseSliceExpression(tok token.Token, left, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.High = p.parseExpression(LOWEST)
+	}
+
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
@@ -1109,7 +1394,30 @@ func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 	return ws
 }
 
-func (p *Parser) parseForStatement() *ast.ForStatement {
+// parseForInStatement parses the rest of a for-in loop, the current token
+// being its last variable.
+func (p *Parser) parseForInStatement(tok token.Token, key, value *ast.Identifier) ast.Statement {
+	fs := &ast.ForInStatement{Token: tok, Key: key, Value: value}
+
+	p.nextToken()
+	p.nextToken()
+
+	fs.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	fs.Body = p.parseBlockStatement()
+
+	return fs
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
 	fs := &ast.ForStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
@@ -1120,13 +1428,26 @@ func (p *Parser) parseForStatement() *ast.ForStatement {
 		return nil
 	}
 
-	fs.Var = p.parseIdentifier()
+	first := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// for (x in arr)
+	if p.peekTokenIs(token.IN) {
+		return p.parseForInStatement(fs.Token, nil, first)
+	}
+
+	fs.Var = first
 
 	if !p.expectPeek(token.COMMA) {
 		return nil
 	}
 	p.nextToken()
 
+	// for (i, x in arr)
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.IN) {
+		value := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		return p.parseForInStatement(fs.Token, first, value)
+	}
+
 	fs.Start = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.COMMA) {
@@ -1156,6 +1477,128 @@ func (p *Parser) parseForStatement() *ast.ForStatement {
 	return fs
 }
 
+func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	stmt := &ast.ReturnStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		return stmt
+	}
+
+	if p.peekTokenIs(token.RBRACE) {
+		return stmt
+	}
+
+	p.nextToken()
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseSwitchStatement() *ast.SwitchStatement {
+	stmt := &ast.SwitchStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.CASE:
+			sc := &ast.SwitchCase{Token: p.curToken}
+
+			p.nextToken()
+			sc.Values = append(sc.Values, p.parseExpression(LOWEST))
+
+			for p.peekTokenIs(token.COMMA) {
+				p.nextToken()
+				p.nextToken()
+				sc.Values = append(sc.Values, p.parseExpression(LOWEST))
+			}
+
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+
+			sc.Body = p.parseCaseBody()
+			stmt.Cases = append(stmt.Cases, sc)
+		case token.DEFAULT:
+			if stmt.Default != nil {
+				p.addError("multiple defaults in switch statement")
+				return nil
+			}
+
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+
+			stmt.Default = p.parseCaseBody()
+		default:
+			p.addError(fmt.Sprintf("Expected case or default, got %s instead", p.curToken.Type))
+			return nil
+		}
+	}
+
+	return stmt
+}
+
+// parseCaseBody parses the statements of a switch case, starting at its colon
+// and ending at the next case, default or at the closing brace of the switch.
+func (p *Parser) parseCaseBody() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.CASE) && !p.curTokenIs(token.DEFAULT) &&
+		!p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+
+	return block
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseIncrementStatement(target ast.Expression) *ast.IncrementStatement {
 	stmt := &ast.IncrementStatement{Token: p.curToken, Var: target}
 	p.nextToken()
@@ -1209,12 +1652,21 @@ func (p *Parser) defaultValueForType(t token.Token) ast.Expression {
 		return &ast.FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: "0.0"}, Value: 0.0}
 	case "bool":
 		return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}
+	case "string":
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: ""}, Value: ""}
 	default:
 		return nil
 	}
 }
 
 func (p *Parser) parseType() *ast.Identifier {
+	if p.curTokenIs(token.FUNC) {
+		return p.parseFunctionType()
+	}
+	if p.curTokenIs(token.MAP) {
+		return p.parseMapType()
+	}
+
 	switch p.curToken.Literal {
 	case "int":
 		return &ast.Identifier{Token: p.curToken, Value: "int"}
@@ -1222,6 +1674,8 @@ func (p *Parser) parseType() *ast.Identifier {
 		return &ast.Identifier{Token: p.curToken, Value: "float"}
 	case "bool":
 		return &ast.Identifier{Token: p.curToken, Value: "bool"}
+	case "string":
+		return &ast.Identifier{Token: p.curToken, Value: "string"}
 	default:
 		if p.peekTokenIs(token.ASSIGN) {
 			return &ast.Identifier{Token: p.curToken, Value: "<unknown>"}
@@ -1230,6 +1684,86 @@ func (p *Parser) parseType() *ast.Identifier {
 	}
 }
 
+// parseFunctionType parses a function type such as `func(int, float[]) bool`.
+// The type is kept in its canonical string form, e.g. "func(int, float[]) bool",
+// so it can be compared like any other type name.
+// parseMapType parses a map type, e.g. `map[string]int`. Keys must be of a
+// hashable type: int, bool or string.
+func (p *Parser) parseMapType() *ast.Identifier {
+	mapToken := p.curToken
+
+	if !p.expectPeek(token.LBRACKET) {
+		return &ast.Identifier{Token: mapToken, Value: "<unknown>"}
+	}
+	p.nextToken()
+
+	key := p.parseType().Value
+	switch key {
+	case "int", "bool", "string":
+	default:
+		p.addError(fmt.Sprintf("map keys must be int, bool or string, got %s", key))
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return &ast.Identifier{Token: mapToken, Value: "<unknown>"}
+	}
+	p.nextToken()
+
+	return &ast.Identifier{
+		Token: mapToken,
+		Value: "map[" + key + "]" + p.parseTypeName(),
+	}
+}
+
+func (p *Parser) parseFunctionType() *ast.Identifier {
+	funcToken := p.curToken
+
+	if !p.expectPeek(token.LPAREN) {
+		return &ast.Identifier{Token: funcToken, Value: "<unknown>"}
+	}
+
+	params := []string{}
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		params = append(params, p.parseTypeName())
+
+		if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+			return &ast.Identifier{Token: funcToken, Value: "<unknown>"}
+		}
+	}
+	p.nextToken()
+
+	if !p.peekTokenIs(token.FUNC) && !p.peekTokenIs(token.MAP) && !p.expectPeek(token.IDENT) {
+		return &ast.Identifier{Token: funcToken, Value: "<unknown>"}
+	}
+	if p.peekTokenIs(token.FUNC) || p.peekTokenIs(token.MAP) {
+		p.nextToken()
+	}
+
+	returnType := p.parseTypeName()
+
+	return &ast.Identifier{
+		Token: funcToken,
+		Value: "func(" + strings.Join(params, ", ") + ") " + returnType,
+	}
+}
+
+// parseTypeName parses a type followed by an optional `[]`, returning its
+// canonical name (e.g. "int" or "int[]").
+func (p *Parser) parseTypeName() string {
+	name := p.parseType().Value
+
+	if p.peekTokenIs(token.LBRACKET) {
+		p.nextToken()
+		if !p.expectPeek(token.RBRACKET) {
+			return name
+		}
+		name += "[]"
+	}
+
+	return name
+}
+
 func (p *Parser) isNextTokenFunctionStatement() bool {
 	// Save the current lexer state
 	backupPosition := p.l.Position
@@ -1238,16 +1772,29 @@ func (p *Parser) isNextTokenFunctionStatement() bool {
 	backupCurToken := p.curToken
 	backupPeekToken := p.peekToken
 
+	// find the ')' matching the '(' of the parameter list, function types in
+	// the parameters have their own parenthesis
+	depth := 0
 	counter := 10000
-	for !p.curTokenIs(token.RPAREN) {
+	for {
+		if p.curTokenIs(token.LPAREN) {
+			depth++
+		} else if p.curTokenIs(token.RPAREN) {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+
 		p.nextToken()
 		counter--
-		if counter == 0 {
-			panic("Oops, expected ) but never found it...")
+		if counter == 0 || p.curTokenIs(token.EOF) {
+			break
 		}
 	}
 
-	isFunction := p.peekTokenIs(token.IDENT)
+	isFunction := p.curTokenIs(token.RPAREN) &&
+		(p.peekTokenIs(token.IDENT) || p.peekTokenIs(token.FUNC) || p.peekTokenIs(token.MAP))
 
 	// Restore the lexer state
 	p.l.Position = backupPosition
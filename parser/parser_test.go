@@ -134,12 +134,14 @@ func TestArrayStatements(t *testing.T) {
 		expectedValue interface{}
 	}{
 		{"int a[];", "int", "a", 1, []int64{0}},
-		{"int v[] = {};", "int", "v", 1, []int64{0}},
+		{"int v[] = {};", "int", "v", 0, []int64{}},
 		{"bool b[];", "bool", "b", 1, []bool{false}},
 		{"float c[];", "float", "c", 1, []float64{0}},
 		{"int x[3]={1, 2, 3};", "int", "x", 3, []int64{1, 2, 3}},
 		{"float y[2]={1.2, 2.3};", "float", "y", 2, []float64{1.2, 2.3}},
 		{"int k[]={1,2,3,4,5};", "int", "k", 5, []int64{1, 2, 3, 4, 5}},
+		{"int w[3] = {};", "int", "w", 3, []int64{0, 0, 0}},
+		{"int z[2] = {1, 2, 3};", "int", "z", 2, []int64{1, 2, 3}},
 	}
 
 	for _, tt := range tests {
@@ -225,6 +227,31 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestSliceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`s[1:3]`, "(s[1:3])"},
+		{`s[:i + 1]`, "(s[:(i + 1)])"},
+		{`s[2:]`, "(s[2:])"},
+		{`s[:]`, "(s[:])"},
+		{`string s = "yail";`, "string s = yail;"},
+		{`string s;`, "string s = ;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestStructsDeclaration(t *testing.T) {
 	input := `
 	structs {
@@ -951,6 +978,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"a % b // c",
+			"((a % b) // c)",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-a ** 2 * b",
+			"((-(a ** 2)) * b)",
+		},
+		{
+			"a | b & c << 1",
+			"(a | ((b & c) << 1))",
+		},
+		{
+			"~a ^ b >> c",
+			"((~a) ^ (b >> c))",
+		},
 		{
 			"!-a",
 			"(!(-a))",
@@ -1180,6 +1227,131 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { 0 }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
+			len(exp.Alternative.Statements))
+	}
+
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Alternative.Statements[0])
+	}
+
+	elseIf, ok := alternative.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not ast.IfExpression. got=%T",
+			alternative.Expression)
+	}
+
+	if !testInfixExpression(t, elseIf.Condition, "x", ">", "y") {
+		return
+	}
+
+	if elseIf.Alternative == nil || len(elseIf.Alternative.Statements) != 1 {
+		t.Fatalf("else if has no else block")
+	}
+}
+
+func TestSwitchStatement(t *testing.T) {
+	input := `
+	switch (x) {
+	case 1, 2:
+		y = 1;
+		z = 2;
+	case "a":
+	default:
+		y = 3;
+	}
+	`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.SwitchStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.SwitchStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Value, "x") {
+		return
+	}
+
+	if len(stmt.Cases) != 2 {
+		t.Fatalf("stmt.Cases does not contain 2 cases. got=%d", len(stmt.Cases))
+	}
+
+	tests := []struct {
+		expectedValues     []interface{}
+		expectedStatements int
+	}{
+		{[]interface{}{1, 2}, 2},
+		{[]interface{}{"a"}, 0},
+	}
+
+	for i, tt := range tests {
+		sc := stmt.Cases[i]
+
+		if len(sc.Values) != len(tt.expectedValues) {
+			t.Fatalf("case %d has wrong number of values. got=%d", i, len(sc.Values))
+		}
+
+		for j, v := range tt.expectedValues {
+			if s, ok := v.(string); ok {
+				str, ok := sc.Values[j].(*ast.StringLiteral)
+				if !ok || str.Value != s {
+					t.Fatalf("case %d value is not %q. got=%s", i, s, sc.Values[j])
+				}
+				continue
+			}
+			testLiteralExpression(t, sc.Values[j], v)
+		}
+
+		if len(sc.Body.Statements) != tt.expectedStatements {
+			t.Fatalf("case %d body does not contain %d statements. got=%d",
+				i, tt.expectedStatements, len(sc.Body.Statements))
+		}
+	}
+
+	if stmt.Default == nil || len(stmt.Default.Statements) != 1 {
+		t.Fatalf("stmt.Default does not contain 1 statement")
+	}
+}
+
 func TestWhileStatement(t *testing.T) {
 	input := `while (x < y) { x = 5; }`
 
@@ -1275,6 +1447,40 @@ func TestForStatement(t *testing.T) {
 	}
 }
 
+func TestBreakContinueStatements(t *testing.T) {
+	input := `while (true) { break; continue }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	whileStmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if len(whileStmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d\n",
+			len(whileStmt.Body.Statements))
+	}
+
+	if _, ok := whileStmt.Body.Statements[0].(*ast.BreakStatement); !ok {
+		t.Fatalf("Statements[0] is not ast.BreakStatement. got=%T",
+			whileStmt.Body.Statements[0])
+	}
+
+	if _, ok := whileStmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Fatalf("Statements[1] is not ast.ContinueStatement. got=%T",
+			whileStmt.Body.Statements[1])
+	}
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -1404,6 +1610,269 @@ func TestFunctionStatementParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestFunctionTypeParsing(t *testing.T) {
+	input := `apply(func(int, float[]) bool f, int x, func() int g) func(int) func(int) int {
+	local {
+		func(int) bool h;
+	}
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	function, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	expectedParams := []struct {
+		Name string
+		Type string
+	}{
+		{Name: "f", Type: "func(int, float[]) bool"},
+		{Name: "x", Type: "int"},
+		{Name: "g", Type: "func() int"},
+	}
+
+	if len(function.Parameters) != len(expectedParams) {
+		t.Fatalf("length parameters wrong. want %d, got=%d\n",
+			len(expectedParams), len(function.Parameters))
+	}
+
+	for i, p := range expectedParams {
+		testTokenType(t, function.Parameters[i].Type, p.Type)
+		testLiteralExpression(t, function.Parameters[i].Name, p.Name)
+	}
+
+	testTokenType(t, function.ReturnType.Type, "func(int) func(int) int")
+
+	local, ok := function.Body.Statements[0].(*ast.LocalStatement)
+	if !ok {
+		t.Fatalf("function.Body.Statements[0] is not ast.LocalStatement. got=%T",
+			function.Body.Statements[0])
+	}
+
+	variable, ok := local.Body.Statements[0].(*ast.VariableStatement)
+	if !ok {
+		t.Fatalf("local.Body.Statements[0] is not ast.VariableStatement. got=%T",
+			local.Body.Statements[0])
+	}
+
+	testTokenType(t, variable.Type, "func(int) bool")
+	testLiteralExpression(t, variable.Name, "h")
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return true;", true},
+		{"return foobar;", "foobar"},
+		{"return;", nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ReturnStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.TokenLiteral() != "return" {
+			t.Fatalf("stmt.TokenLiteral not 'return', got %q", stmt.TokenLiteral())
+		}
+
+		if tt.expectedValue == nil {
+			if stmt.ReturnValue != nil {
+				t.Fatalf("stmt.ReturnValue is not nil. got=%T", stmt.ReturnValue)
+			}
+			continue
+		}
+
+		testLiteralExpression(t, stmt.ReturnValue, tt.expectedValue)
+	}
+}
+
+func TestStructLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedFields []string
+		expectedValues []interface{}
+	}{
+		{"point2D{ x = 1, y = true };", "point2D", []string{"x", "y"}, []interface{}{1, true}},
+		{"point2D{ x = a, };", "point2D", []string{"x"}, []interface{}{"a"}},
+		{"point2D{};", "point2D", []string{}, []interface{}{}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		lit, ok := stmt.Expression.(*ast.StructLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.StructLiteral. got=%T", stmt.Expression)
+		}
+
+		if lit.Name.Value != tt.expectedName {
+			t.Fatalf("lit.Name not %q. got=%q", tt.expectedName, lit.Name.Value)
+		}
+
+		if len(lit.Fields) != len(tt.expectedFields) {
+			t.Fatalf("wrong number of fields. want=%d, got=%d",
+				len(tt.expectedFields), len(lit.Fields))
+		}
+
+		for i, field := range tt.expectedFields {
+			if lit.Fields[i].Value != field {
+				t.Errorf("field %d not %q. got=%q", i, field, lit.Fields[i].Value)
+			}
+			testLiteralExpression(t, lit.Values[i], tt.expectedValues[i])
+		}
+	}
+}
+
+func TestStructTypedFunctionParsing(t *testing.T) {
+	input := `move(point2D p, q, float d) point2D { move = p; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+
+	expectedTypes := []string{"point2D", "point2D", "float"}
+	if len(fn.Parameters) != len(expectedTypes) {
+		t.Fatalf("wrong number of parameters. want=%d, got=%d",
+			len(expectedTypes), len(fn.Parameters))
+	}
+
+	for i, typ := range expectedTypes {
+		if fn.Parameters[i].Type.Value != typ {
+			t.Errorf("parameter %d type not %q. got=%q", i, typ, fn.Parameters[i].Type.Value)
+		}
+	}
+
+	if fn.ReturnType.Type.Value != "point2D" {
+		t.Errorf("return type not %q. got=%q", "point2D", fn.ReturnType.Type.Value)
+	}
+}
+
+func TestMultiDimensionalArrayParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"float m[2][3];", "float m[2][3] = {{0.0, 0.0, 0.0}, {0.0, 0.0, 0.0}};"},
+		{"int m[2][2] = {{1, 2}, {3, 4}};", "int m[2][2] = {{1, 2}, {3, 4}};"},
+		{"int m[2][] = {{1}, {2, 3}};", "int m[2][] = {{1}, {2, 3}};"},
+		{"m[1][0] = 5;", "((m[1])[0]) = 5;"},
+		{"trace(int m[][]) int[][] { }", "trace(int m[1][]) int[1][] "},
+		{"int b[] = reverse(a);", "int b[] = reverse(a);"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestMapParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map[string]int m = {"a": 1, "b": 2};`, "map[string]int m = {a: 1, b: 2};"},
+		{`map[int]bool m = {1: true};`, "map[int]bool m = {1: true};"},
+		{`map[string]int[] m;`, "map[string]int[] m = ;"},
+		{`m = {"a": 1 + 2};`, "m = {a: (1 + 2)};"},
+		{`m["a"] = 3;`, "(m[a]) = 3;"},
+		{`count(map[int]bool seen, int n) map[string]int { }`, "count(map[int]bool seen, int n) map[string]int "},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("map[float]int m;"))
+	p.ParseProgram()
+
+	expected := "Line 1: map keys must be int, bool or string, got float"
+	if len(p.Errors()) != 1 || p.Errors()[0] != expected {
+		t.Errorf("expected error %q, got=%v", expected, p.Errors())
+	}
+}
+
+func TestForInParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (x in a) { s = s + x; }", "for (x in a) s = (s + x);"},
+		{"for (i, x in a) { }", "for (i, x in a) "},
+		{`for (c in "abc") { }`, "for (c in abc) "},
+		{"for (i, a, b, 1) { }", "for (i, a, b, 1) "},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
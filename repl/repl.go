@@ -71,20 +71,27 @@ func RunAst(in io.Reader, out io.Writer) {
 	}
 }
 
-func RunVm(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+// RunVm runs the read-eval-print loop of the virtual machine. The programs
+// read from in and write to out, like the loop itself. With checkedArith, an
+// integer overflow is reported instead of wrapping around.
+func RunVm(in io.Reader, out io.Writer, checkedArith bool) {
+	// the loop and the programs share the same buffered reader, so that a
+	// line typed for a call to read isn't swallowed by the loop
+	reader := bufio.NewReader(in)
 
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalsSize)
 	symbolTable := compiler.NewSymbolTable()
+	for _, b := range object.Builtins.All() {
+		symbolTable.DefineBuiltin(b.ID, b.Name)
+	}
 
 	for {
 		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
 			return
 		}
-		line := scanner.Text()
 		l := lexer.New(line)
 		p := parser.New(l)
 		program := p.ParseProgram()
@@ -93,7 +100,7 @@ func RunVm(in io.Reader, out io.Writer) {
 			continue
 		}
 		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
+		err = comp.Compile(program)
 		if err != nil {
 			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 			continue
@@ -101,8 +108,14 @@ func RunVm(in io.Reader, out io.Writer) {
 		code := comp.Bytecode()
 		constants = code.Constants
 		machine := vm.NewWithGlobalsStore(code, globals)
+		machine.CheckArithmetic(checkedArith)
+		machine.SetIO(reader, out)
 		err = machine.Run()
 		if err != nil {
+			if runtimeErr, ok := err.(*vm.RuntimeError); ok {
+				fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", runtimeErr.StackTrace())
+				continue
+			}
 			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
 			continue
 		}
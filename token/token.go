@@ -23,6 +23,16 @@ const (
 	ASTERISK = "*"
 	SLASH    = "/"
 
+	PERCENT     = "%"
+	FLOOR_DIV   = "//"
+	POWER       = "**"
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	CARET       = "^"
+	TILDE       = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+
 	AND = "AND"
 	OR  = "OR"
 	LT  = "<"
@@ -42,6 +52,7 @@ const (
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -51,16 +62,25 @@ const (
 	RBRACKET = "]"
 
 	// Keywords
-	TRUE    = "TRUE"
-	FALSE   = "FALSE"
-	IF      = "IF"
-	ELSE    = "ELSE"
-	STRUCTS = "STRUCTS"
-	GLOBAL  = "GLOBAL"
-	LOCAL   = "LOCAL"
-	CONST   = "CONST"
-	WHILE   = "WHILE"
-	FOR     = "FOR"
+	TRUE     = "TRUE"
+	FALSE    = "FALSE"
+	IF       = "IF"
+	ELSE     = "ELSE"
+	STRUCTS  = "STRUCTS"
+	GLOBAL   = "GLOBAL"
+	LOCAL    = "LOCAL"
+	CONST    = "CONST"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	FUNC     = "FUNC"
+	RETURN   = "RETURN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	SWITCH   = "SWITCH"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
+	MAP      = "MAP"
+	IN       = "IN"
 )
 
 type TokenType string
@@ -71,18 +91,27 @@ type Token struct {
 }
 
 var keywords = map[string]TokenType{
-	"true":    TRUE,
-	"false":   FALSE,
-	"if":      IF,
-	"else":    ELSE,
-	"structs": STRUCTS,
-	"const":   CONST,
-	"global":  GLOBAL,
-	"local":   LOCAL,
-	"while":   WHILE,
-	"and":     AND,
-	"or":      OR,
-	"for":     FOR,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"structs":  STRUCTS,
+	"const":    CONST,
+	"global":   GLOBAL,
+	"local":    LOCAL,
+	"while":    WHILE,
+	"and":      AND,
+	"or":       OR,
+	"for":      FOR,
+	"func":     FUNC,
+	"return":   RETURN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"switch":   SWITCH,
+	"case":     CASE,
+	"default":  DEFAULT,
+	"map":      MAP,
+	"in":       IN,
 }
 
 func LookupIdent(ident string) TokenType {
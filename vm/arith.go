@@ -0,0 +1,15 @@
+package vm
+
+import "github.com/odas0r/yail/code"
+
+// integerOperators are the symbols of the integer operators that may overflow,
+// used to report the overflow in checked arithmetic mode.
+var integerOperators = map[code.Opcode]string{
+	code.OpAdd:       "+",
+	code.OpSub:       "-",
+	code.OpMul:       "*",
+	code.OpDiv:       "/",
+	code.OpFloorDiv:  "//",
+	code.OpPow:       "**",
+	code.OpShiftLeft: "<<",
+}
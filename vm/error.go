@@ -0,0 +1,88 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RuntimeError is an error raised while running a program. Error returns its
+// message only, StackTrace adds the functions being called when it happened.
+type RuntimeError struct {
+	Message string
+	Trace   []string // functions being called, innermost first, see runtimeError
+	Err     error    // the error raised by the instruction
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// StackTrace returns the message of the error followed by one line per
+// function being called, e.g.
+//
+//	division by zero
+//		at divide
+//		at <main>
+func (e *RuntimeError) StackTrace() string {
+	var out strings.Builder
+
+	out.WriteString(e.Message)
+	for _, fn := range e.Trace {
+		out.WriteString("\n\tat ")
+		out.WriteString(fn)
+	}
+
+	return out.String()
+}
+
+// maxTraceLength is the number of entries kept in the trace of a
+// *RuntimeError, the last one counting the frames left out.
+const maxTraceLength = 100
+
+// runtimeError wraps err, raised by the current instruction, into a
+// *RuntimeError. Consecutive calls to the same function, as in a recursion,
+// take one entry of the trace, e.g. "f (×65536)".
+func (vm *VM) runtimeError(err error) *RuntimeError {
+	var trace []string
+	for i := vm.frameIndex - 1; i >= 0; {
+		fn := vm.frames[i].fn
+		calls := 0
+		for ; i >= 0 && vm.frames[i].fn == fn; i-- {
+			calls++
+		}
+
+		if len(trace) == maxTraceLength-1 {
+			trace = append(trace, fmt.Sprintf("... (%d more frames)", i+1+calls))
+			break
+		}
+
+		name := fn.Name
+		if name == "" {
+			name = "<main>"
+		}
+		if calls > 1 {
+			name = fmt.Sprintf("%s (×%d)", name, calls)
+		}
+		trace = append(trace, name)
+	}
+
+	return &RuntimeError{Message: err.Error(), Trace: trace, Err: err}
+}
+
+// StackOverflowError is raised when calling a function, or pushing a value in
+// a function, would exceed the limits of the stacks: Err is ErrCallDepth when
+// too many calls are in progress and ErrStackOverflow when the value stack is
+// full.
+type StackOverflowError struct {
+	Function string // empty for the main program
+	Err      error
+}
+
+func (e *StackOverflowError) Error() string {
+	name := e.Function
+	if name == "" {
+		name = "<main>"
+	}
+	return "stack overflow in function " + name
+}
+
+func (e *StackOverflowError) Unwrap() error { return e.Err }
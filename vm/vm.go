@@ -1,7 +1,12 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"unicode/utf8"
 
 	"github.com/odas0r/yail/code"
 	"github.com/odas0r/yail/compiler"
@@ -9,16 +14,51 @@ import (
 )
 
 const (
-	StackSize   = 2048
 	GlobalsSize = 65536
-	MaxFrames   = 1024
+
+	// the value and frame stacks start with StackSize values and FramesSize
+	// frames, and grow as needed up to the limits of the program, which are
+	// MaxStackSize and MaxCallDepth unless Limits says otherwise
+	StackSize    = 2048
+	FramesSize   = 64
+	MaxStackSize = 1 << 20
+	MaxCallDepth = 1 << 16
 )
 
 // Errors
 var (
-	ErrStackOverflow = fmt.Errorf("stack overflow")
+	ErrStackOverflow  = errors.New("stack overflow")
+	ErrStackUnderflow = errors.New("stack underflow")
+
+	// the errors of a program stopped by one of its limits
+	ErrInstructionLimit = errors.New("instruction limit exceeded")
+	ErrCallDepth        = errors.New("maximum call depth exceeded")
+	ErrMemoryLimit      = errors.New("memory limit exceeded")
 )
 
+// checkInterval is the number of instructions executed between two checks of
+// the context of a run.
+const checkInterval = 1024
+
+// Limits bound the resources a program may use, a zero field meaning no
+// limit, except for the stacks which are then bounded by MaxCallDepth and
+// MaxStackSize.
+type Limits struct {
+	// MaxInstructions is the number of instructions the program may execute.
+	MaxInstructions int64
+	// MaxCallDepth is the number of function calls that may be in progress
+	// at once.
+	MaxCallDepth int
+	// MaxStackSize is the number of values the value stack may hold, the
+	// arguments and local variables of the functions being called among
+	// them.
+	MaxStackSize int
+	// MaxAllocations is the number of values the program may allocate over
+	// its run: each array element, map pair and struct field, and each byte
+	// of a string built by the program counts as one.
+	MaxAllocations int64
+}
+
 // Globals
 var (
 	True  = &object.Boolean{Value: true}
@@ -36,16 +76,25 @@ type VM struct {
 
 	frames     []*Frame
 	frameIndex int
+
+	// runtime is the state given to the builtins
+	runtime *object.Runtime
+
+	// builtins are the builtins the program was compiled with
+	builtins *object.Registry
+
+	limits   Limits
+	executed int64 // number of instructions executed so far
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
 	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
 	mainFrame := NewFrame(mainFn, 0)
 
-	frames := make([]*Frame, MaxFrames)
+	frames := make([]*Frame, FramesSize)
 	frames[0] = mainFrame
 
-	return &VM{
+	vm := &VM{
 		constants:    bytecode.Constants,
 		instructions: bytecode.Instructions,
 
@@ -54,7 +103,11 @@ func New(bytecode *compiler.Bytecode) *VM {
 		globals:    make([]object.Object, GlobalsSize),
 		frames:     frames,
 		frameIndex: 1,
+		runtime:    object.NewRuntime(),
+		builtins:   object.Builtins,
 	}
+	vm.SetLimits(Limits{})
+	return vm
 }
 
 func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
@@ -63,13 +116,86 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	return vm
 }
 
-// fetch - decode - execute cycle
+// CheckArithmetic enables or disables the checked arithmetic mode, in which a
+// signed integer overflow is a runtime error instead of wrapping around. The
+// integer builtins, e.g. div, return an error instead.
+func (vm *VM) CheckArithmetic(enabled bool) {
+	vm.runtime.SetCheckedArithmetic(enabled)
+}
+
+// SetIO makes the program read from in and write to out instead of the
+// standard input and output.
+func (vm *VM) SetIO(in io.Reader, out io.Writer) {
+	vm.runtime.SetIO(in, out)
+}
+
+// UseBuiltins makes the program call the builtins of r, which must be the
+// registry the program was compiled with.
+func (vm *VM) UseBuiltins(r *object.Registry) {
+	vm.builtins = r
+}
+
+// SetLimits bounds the resources the program may use.
+func (vm *VM) SetLimits(limits Limits) {
+	if limits.MaxCallDepth == 0 {
+		limits.MaxCallDepth = MaxCallDepth
+	}
+	if limits.MaxStackSize == 0 {
+		limits.MaxStackSize = MaxStackSize
+	}
+
+	vm.limits = limits
+	vm.runtime.SetAllocationLimit(limits.MaxAllocations)
+}
+
+// Run executes the bytecode. A failure is reported as a *RuntimeError holding
+// the functions that were being called.
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext executes the bytecode like Run, stopping with the error of ctx
+// once it is done, e.g. context.DeadlineExceeded after a timeout. A program
+// stopped by one of its limits fails with ErrInstructionLimit, ErrCallDepth or
+// ErrMemoryLimit, which errors.Is finds in the *RuntimeError.
+func (vm *VM) RunContext(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(stackUnderflow); !ok {
+				panic(r)
+			}
+			err = vm.runtimeError(ErrStackUnderflow)
+		}
+	}()
+
+	err = vm.run(ctx)
+	if err != nil {
+		return vm.runtimeError(err)
+	}
+	return nil
+}
+
+// fetch - decode - execute cycle
+func (vm *VM) run(ctx context.Context) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
+	done := ctx.Done()
+
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.executed++
+		if vm.limits.MaxInstructions > 0 && vm.executed > vm.limits.MaxInstructions {
+			return ErrInstructionLimit
+		}
+		if done != nil && vm.executed%checkInterval == 0 {
+			select {
+			case <-done:
+				return ctx.Err()
+			default:
+			}
+		}
+
 		vm.currentFrame().ip++
 
 		ip = vm.currentFrame().ip
@@ -89,7 +215,9 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpMod, code.OpFloorDiv, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -109,6 +237,20 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpBitNot:
+			err := vm.executeBitNotOperator()
+			if err != nil {
+				return err
+			}
+		case code.OpCurrentFn:
+			err := vm.push(vm.currentFrame().fn)
+			if err != nil {
+				return err
+			}
+		case code.OpToFloat:
+			if integer, ok := vm.stack[vm.sp-1].(*object.Integer); ok {
+				vm.stack[vm.sp-1] = &object.Float{Value: float64(integer.Value)}
+			}
 		case code.OpTrue:
 			err := vm.push(True)
 			if err != nil {
@@ -123,6 +265,54 @@ func (vm *VM) Run() error {
 			pos := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip = pos - 1
 
+		case code.OpIter:
+			iterable := vm.pop()
+
+			it, ok := object.NewIterator(iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", iterable.Type())
+			}
+
+			err := vm.push(it)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			numVars := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			it := vm.pop().(*object.Iterator)
+			key, value, ok := it.Next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				continue
+			}
+
+			if numVars == 2 {
+				err := vm.push(key)
+				if err != nil {
+					return err
+				}
+				err = vm.push(value)
+				if err != nil {
+					return err
+				}
+			} else {
+				err := vm.push(it.Single(key, value))
+				if err != nil {
+					return err
+				}
+			}
+
+		case code.OpJumpTable:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			table := vm.constants[constIndex].(*object.JumpTable)
+			vm.currentFrame().ip = table.Lookup(vm.pop()) - 1
+
 		case code.OpJumpNotTruthy:
 			pos := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -131,24 +321,72 @@ func (vm *VM) Run() error {
 			if !isTruthy(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
+		case code.OpFillArray:
+			numElements := int(code.ReadUint32(ins[ip+1:]))
+			vm.currentFrame().ip += 4
+
+			err := vm.allocate(int64(numElements))
+			if err != nil {
+				return err
+			}
+
+			array, err := vm.fillArray(vm.pop(), numElements)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(array)
+			if err != nil {
+				return err
+			}
 		case code.OpArray:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
 
-			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			err := vm.allocate(int64(numElements))
+			if err != nil {
+				return err
+			}
+
+			array, err := vm.buildArray(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(array)
+			if err != nil {
+				return err
+			}
+		case code.OpMap:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err := vm.allocate(int64(numElements / 2))
+			if err != nil {
+				return err
+			}
+
+			m, err := vm.buildMap(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
 			vm.sp = vm.sp - numElements
 
-			err := vm.push(array)
+			err = vm.push(m)
 			if err != nil {
 				return err
 			}
 		case code.OpGetBuiltin:
-			builtinIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			id := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
 
-			definition := object.Builtins[builtinIndex]
+			builtin, ok := vm.builtins.Get(id)
+			if !ok {
+				return fmt.Errorf("unknown builtin %d", id)
+			}
 
-			err := vm.push(definition.Builtin)
+			err := vm.push(builtin)
 			if err != nil {
 				return err
 			}
@@ -181,24 +419,53 @@ func (vm *VM) Run() error {
 			}
 
 		case code.OpStruct:
-			numElements := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFields := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			structType := vm.constants[constIndex].(*object.StructType)
 
-			startIndex := vm.sp - numElements
-			endIndex := vm.sp
+			err := vm.allocate(structType.Size())
+			if err != nil {
+				return err
+			}
 
-			strct, err := vm.buildStruct(startIndex, endIndex)
+			startIndex := vm.sp - numFields*2
+			strct, err := vm.buildStruct(structType, startIndex, vm.sp)
 			if err != nil {
 				return err
 			}
 
-			// Adjust the stack pointer to remove the attribute names and values
+			// Adjust the stack pointer to remove the field names and values
 			vm.sp = startIndex
 
 			err = vm.push(strct)
 			if err != nil {
 				return err
 			}
+		case code.OpGetAttribute:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[constIndex].(*object.String).Value
+			left := vm.pop()
+
+			err := vm.executeGetAttribute(left, name)
+			if err != nil {
+				return err
+			}
+		case code.OpSetAttribute:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[constIndex].(*object.String).Value
+			value := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetAttribute(left, name, value)
+			if err != nil {
+				return err
+			}
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
@@ -207,6 +474,24 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSlice(left, low, high)
+			if err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
@@ -219,7 +504,11 @@ func (vm *VM) Run() error {
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
-			vm.globals[globalIndex] = vm.pop()
+			value, err := vm.copyStruct(vm.pop())
+			if err != nil {
+				return err
+			}
+			vm.globals[globalIndex] = value
 
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
@@ -238,7 +527,11 @@ func (vm *VM) Run() error {
 
 			frame := vm.currentFrame()
 
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+			value, err := vm.copyStruct(vm.pop())
+			if err != nil {
+				return err
+			}
+			vm.stack[frame.basePointer+int(localIndex)] = value
 
 		case code.OpNull:
 			err := vm.push(Null)
@@ -264,15 +557,48 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 }
 
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return ErrStackOverflow
+	err := vm.growStack(vm.sp + 1)
+	if err != nil {
+		return err
 	}
 	vm.stack[vm.sp] = o
 	vm.sp++
 	return nil
 }
 
+// growStack makes room for size values on the stack, failing when the stack
+// can't hold that many.
+func (vm *VM) growStack(size int) error {
+	max := vm.limits.MaxStackSize
+	if size > max {
+		return &StackOverflowError{Function: vm.currentFrame().fn.Name, Err: ErrStackOverflow}
+	}
+	if size <= len(vm.stack) {
+		return nil
+	}
+
+	newSize := 2 * len(vm.stack)
+	for newSize < size {
+		newSize *= 2
+	}
+	if newSize > max {
+		newSize = max
+	}
+
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+	return nil
+}
+
+// stackUnderflow is the panic of a pop from an empty stack, RunContext
+// recovers from it. Only malformed bytecode pops more values than it pushed.
+type stackUnderflow struct{}
+
 func (vm *VM) pop() object.Object {
+	if vm.sp == 0 {
+		panic(stackUnderflow{})
+	}
 	o := vm.stack[vm.sp-1]
 	vm.sp--
 	return o
@@ -291,30 +617,124 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 		return vm.executeBinaryStringOperation(op, left, right)
 	}
 
+	// an integer operand is converted when the other one is a float
+	leftVal, leftOk := floatValue(left)
+	rightVal, rightOk := floatValue(right)
+	if leftOk && rightOk {
+		return vm.executeBinaryFloatOperation(op, leftVal, rightVal)
+	}
+
 	return fmt.Errorf("unsupported types for binary operation: %s %s", leftType, rightType)
 }
 
+// floatValue returns the value of an integer or a float as a float64.
+func floatValue(obj object.Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value), true
+	case *object.Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
 func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	switch op {
+	case code.OpDiv, code.OpMod, code.OpFloorDiv:
+		if rightVal == 0 {
+			return fmt.Errorf("division by zero")
+		}
+	case code.OpPow:
+		if rightVal < 0 {
+			return fmt.Errorf("negative exponent for integer power: %d", rightVal)
+		}
+	case code.OpShiftLeft, code.OpShiftRight:
+		if rightVal < 0 {
+			return fmt.Errorf("negative shift count: %d", rightVal)
+		}
+	}
+
 	var result int64
+	var overflow bool
 	switch op {
 	case code.OpAdd:
 		result = leftVal + rightVal
+		overflow = (leftVal > 0 && rightVal > 0 && result < 0) ||
+			(leftVal < 0 && rightVal < 0 && result >= 0)
 	case code.OpSub:
 		result = leftVal - rightVal
+		overflow = (leftVal >= 0 && rightVal < 0 && result < 0) ||
+			(leftVal < 0 && rightVal > 0 && result >= 0)
 	case code.OpMul:
-		result = leftVal * rightVal
+		result, overflow = object.IntMul(leftVal, rightVal)
 	case code.OpDiv:
 		result = leftVal / rightVal
+		overflow = leftVal == math.MinInt64 && rightVal == -1
+	case code.OpMod:
+		// the remainder of /, it has the sign of the dividend
+		result = leftVal % rightVal
+	case code.OpFloorDiv:
+		result = leftVal / rightVal
+		if leftVal%rightVal != 0 && (leftVal < 0) != (rightVal < 0) {
+			result--
+		}
+		overflow = leftVal == math.MinInt64 && rightVal == -1
+	case code.OpPow:
+		result, overflow = object.IntPow(leftVal, rightVal)
+	case code.OpBitAnd:
+		result = leftVal & rightVal
+	case code.OpBitOr:
+		result = leftVal | rightVal
+	case code.OpBitXor:
+		result = leftVal ^ rightVal
+	case code.OpShiftLeft:
+		result = leftVal << rightVal
+		overflow = result>>rightVal != leftVal
+	case code.OpShiftRight:
+		result = leftVal >> rightVal
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
 
+	if overflow && vm.runtime.CheckedArithmetic() {
+		return fmt.Errorf("integer overflow: %d %s %d", leftVal, integerOperators[op], rightVal)
+	}
+
 	return vm.push(&object.Integer{Value: result})
 }
 
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, leftVal, rightVal float64) error {
+	var result float64
+	switch op {
+	case code.OpAdd:
+		result = leftVal + rightVal
+	case code.OpSub:
+		result = leftVal - rightVal
+	case code.OpMul:
+		result = leftVal * rightVal
+	case code.OpDiv:
+		result = leftVal / rightVal
+	case code.OpMod:
+		result = math.Mod(leftVal, rightVal)
+	case code.OpFloorDiv:
+		result = math.Floor(leftVal / rightVal)
+	case code.OpPow:
+		result = math.Pow(leftVal, rightVal)
+	default:
+		def, err := code.Lookup(byte(op))
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("unsupported operator for FLOAT: %s", def.Name)
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
@@ -322,6 +742,10 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 	var result string
 	switch op {
 	case code.OpAdd:
+		err := vm.allocate(int64(len(leftVal) + len(rightVal)))
+		if err != nil {
+			return err
+		}
 		result = leftVal + rightVal
 	default:
 		return fmt.Errorf("unknown string operator: %d", op)
@@ -341,6 +765,25 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+
+	// an integer is compared to a float as a float
+	if leftType == object.FLOAT_OBJ || rightType == object.FLOAT_OBJ {
+		leftVal, leftOk := floatValue(left)
+		rightVal, rightOk := floatValue(right)
+		if leftOk && rightOk {
+			return vm.executeFloatComparison(op, leftVal, rightVal)
+		}
+	}
+
+	// booleans held by structs are not the shared True and False objects
+	if leftType == object.BOOLEAN_OBJ && rightType == object.BOOLEAN_OBJ {
+		left = nativeBoolToBooleanObject(left.(*object.Boolean).Value)
+		right = nativeBoolToBooleanObject(right.(*object.Boolean).Value)
+	}
+
 	// Here we can compare *object.Object memory addresses, and this works
 	// because we only have one boolean object for each value (they are defined
 	// globally above). So we can compare the addresses and not the values.
@@ -373,15 +816,43 @@ func (vm *VM) executeIntegerComparison(
 	}
 }
 
+func (vm *VM) executeFloatComparison(op code.Opcode, leftValue, rightValue float64) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeStringComparison(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
 func (vm *VM) executeBangOperator() error {
 	operand := vm.pop()
 
-	switch operand {
-	case True:
-		return vm.push(False)
-	case False:
-		return vm.push(True)
-	case Null:
+	switch operand := operand.(type) {
+	case *object.Boolean:
+		return vm.push(nativeBoolToBooleanObject(!operand.Value))
+	case *object.Null:
 		return vm.push(True)
 	default:
 		return vm.push(False)
@@ -391,18 +862,38 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		if operand.Value == math.MinInt64 && vm.runtime.CheckedArithmetic() {
+			return fmt.Errorf("integer overflow: -(%d)", operand.Value)
+		}
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 	}
+}
+
+func (vm *VM) executeBitNotOperator() error {
+	operand := vm.pop()
+
+	if operand.Type() != object.INTEGER_OBJ {
+		return fmt.Errorf("unsupported type for bitwise not: %s", operand.Type())
+	}
 
 	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return vm.push(&object.Integer{Value: ^value})
 }
 
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.MAP_OBJ:
+		return vm.executeMapIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
 	// case left.Type() == object.STRUCT_OBJ:
 	// 	return vm.executeStructIndex(left, index)
 	default:
@@ -413,23 +904,204 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
 	indexObject := index.(*object.Integer)
-	max := int64(len(arrayObject.Elements) - 1)
-	if indexObject.Value < 0 || indexObject.Value > max {
-		return vm.push(Null)
+	if err := checkBounds(arrayObject, indexObject.Value); err != nil {
+		return err
 	}
 	return vm.push(arrayObject.Elements[indexObject.Value])
 }
 
-func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+// executeStringIndex pushes the character at the given position of a string.
+// Strings are indexed by runes, not bytes.
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	runes := []rune(str.(*object.String).Value)
+	i := index.(*object.Integer).Value
+	if i < 0 || i >= int64(len(runes)) {
+		return fmt.Errorf("index out of range: %d (length %d)", i, len(runes))
+	}
+	return vm.push(&object.String{Value: string(runes[i])})
+}
+
+// executeSlice pushes the part of a string or an array between low and high.
+// A null bound stands for the start or the end of the sliced value.
+func (vm *VM) executeSlice(left, low, high object.Object) error {
+	var length int
+	switch left := left.(type) {
+	case *object.String:
+		length = utf8.RuneCountInString(left.Value)
+	case *object.Array:
+		length = len(left.Elements)
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+
+	lo, err := sliceBound(low, 0)
+	if err != nil {
+		return err
+	}
+	hi, err := sliceBound(high, int64(length))
+	if err != nil {
+		return err
+	}
+
+	if lo < 0 || hi > int64(length) || lo > hi {
+		return fmt.Errorf("slice bounds out of range: [%d:%d] (length %d)", lo, hi, length)
+	}
+
+	err = vm.allocate(hi - lo)
+	if err != nil {
+		return err
+	}
+
+	if str, ok := left.(*object.String); ok {
+		return vm.push(&object.String{Value: string([]rune(str.Value)[lo:hi])})
+	}
+
+	elements := make([]object.Object, hi-lo)
+	for i, element := range left.(*object.Array).Elements[lo:hi] {
+		elements[i], err = vm.copyStruct(element)
+		if err != nil {
+			return err
+		}
+	}
+	return vm.push(&object.Array{Elements: elements})
+}
+
+// sliceBound returns the value of a bound of a slice, or def if it is missing.
+func sliceBound(bound object.Object, def int64) (int64, error) {
+	switch bound := bound.(type) {
+	case *object.Null:
+		return def, nil
+	case *object.Integer:
+		return bound.Value, nil
+	default:
+		return 0, fmt.Errorf("slice bounds must be INTEGER, got %s", bound.Type())
+	}
+}
+
+func (vm *VM) executeMapIndex(m, index object.Object) error {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as map key: %s", index.Type())
+	}
+
+	value, ok := m.(*object.Map).Get(key)
+	if !ok {
+		return fmt.Errorf("key not found: %s", index.Inspect())
+	}
+
+	return vm.push(value)
+}
+
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	if m, ok := left.(*object.Map); ok {
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as map key: %s", index.Type())
+		}
+
+		value, err := vm.copyStruct(value)
+		if err != nil {
+			return err
+		}
+		m.Set(key, value)
+		return nil
+	}
+
+	array, ok := left.(*object.Array)
+	if !ok {
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+	}
+
+	if err := checkBounds(array, i.Value); err != nil {
+		return err
+	}
+
+	value, err := vm.copyStruct(value)
+	if err != nil {
+		return err
+	}
+	array.Elements[i.Value] = value
+	return nil
+}
+
+// checkBounds fails when index is not a valid position of array.
+func checkBounds(array *object.Array, index int64) error {
+	if index < 0 || index >= int64(len(array.Elements)) {
+		return fmt.Errorf("index out of range: %d (length %d)", index, len(array.Elements))
+	}
+	return nil
+}
+
+// allocate accounts for n values allocated by the program, failing once it
+// allocated more than its limit.
+func (vm *VM) allocate(n int64) error {
+	if !vm.runtime.Allocate(n) {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) (object.Object, error) {
 	elements := make([]object.Object, endIndex-startIndex)
 	for i := startIndex; i < endIndex; i++ {
-		elements[i-startIndex] = vm.stack[i]
+		element, err := vm.copyStruct(vm.stack[i])
+		if err != nil {
+			return nil, err
+		}
+		elements[i-startIndex] = element
 	}
-	return &object.Array{Elements: elements}
+	return &object.Array{Elements: elements}, nil
 }
 
-func (vm *VM) buildStruct(startIndex, endIndex int) (object.Object, error) {
-	attributes := make(map[string]object.Object)
+// fillArray creates an array of n copies of element, each of them accounted
+// for when it holds other values, e.g. the rows of a matrix.
+func (vm *VM) fillArray(element object.Object, n int) (object.Object, error) {
+	elements := make([]object.Object, n)
+	for i := range elements {
+		if i == 0 {
+			elements[i] = element
+			continue
+		}
+
+		err := vm.allocate(object.Size(element))
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = object.CopyValue(element)
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+// buildMap creates a map from the keys and values between startIndex and
+// endIndex, a later pair replaces an earlier one with the same key.
+func (vm *VM) buildMap(startIndex, endIndex int) (object.Object, error) {
+	m := object.NewMap()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key, ok := vm.stack[i].(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as map key: %s", vm.stack[i].Type())
+		}
+
+		value, err := vm.copyStruct(vm.stack[i+1])
+		if err != nil {
+			return nil, err
+		}
+		m.Set(key, value)
+	}
+
+	return m, nil
+}
+
+// buildStruct creates a new instance of a struct, the fields set by a struct
+// literal are pairs of name and value between startIndex and endIndex.
+func (vm *VM) buildStruct(structType *object.StructType, startIndex, endIndex int) (object.Object, error) {
+	strct := structType.New()
 
 	for i := startIndex; i < endIndex; i += 2 {
 		key, ok := vm.stack[i].(*object.String)
@@ -437,10 +1109,61 @@ func (vm *VM) buildStruct(startIndex, endIndex int) (object.Object, error) {
 			return nil, fmt.Errorf("key must be string: %s", vm.stack[i].Type())
 		}
 
-		attributes[key.Value] = vm.stack[i+1]
+		err := vm.executeSetAttribute(strct, key.Value, vm.stack[i+1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return strct, nil
+}
+
+func (vm *VM) executeGetAttribute(left object.Object, name string) error {
+	strct, ok := left.(*object.Struct)
+	if !ok {
+		return fmt.Errorf("attribute access not supported: %s", left.Type())
 	}
 
-	return &object.Struct{Attributes: attributes}, nil
+	value, ok := strct.Attributes[name]
+	if !ok {
+		return fmt.Errorf("unknown field %s in struct %s", name, strct.StructType.Name)
+	}
+
+	return vm.push(value)
+}
+
+func (vm *VM) executeSetAttribute(left object.Object, name string, value object.Object) error {
+	strct, ok := left.(*object.Struct)
+	if !ok {
+		return fmt.Errorf("attribute access not supported: %s", left.Type())
+	}
+
+	if _, ok := strct.Attributes[name]; !ok {
+		return fmt.Errorf("unknown field %s in struct %s", name, strct.StructType.Name)
+	}
+
+	value, err := vm.copyStruct(value)
+	if err != nil {
+		return err
+	}
+	strct.Attributes[name] = value
+	return nil
+}
+
+// copyStruct copies struct values before they are stored, structs have value
+// semantics while every other object is either immutable or shared. The copy
+// is accounted for with all the values it holds.
+func (vm *VM) copyStruct(obj object.Object) (object.Object, error) {
+	strct, ok := obj.(*object.Struct)
+	if !ok {
+		return obj, nil
+	}
+
+	err := vm.allocate(object.Size(strct))
+	if err != nil {
+		return nil, err
+	}
+	return strct.Copy(), nil
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -464,6 +1187,9 @@ func isTruthy(obj object.Object) bool {
 // Frames
 
 func (vm *VM) pushFrame(f *Frame) {
+	if vm.frameIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, make([]*Frame, len(vm.frames))...)
+	}
 	vm.frames[vm.frameIndex] = f
 	vm.frameIndex++
 }
@@ -493,7 +1219,27 @@ func (vm *VM) callFunction(fn *object.CompiledFunction, numArgs int) error {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
 			fn.NumParameters, numArgs)
 	}
+
+	// the main program is the first frame, it isn't a call
+	if vm.frameIndex-1 >= vm.limits.MaxCallDepth {
+		return &StackOverflowError{Function: fn.Name, Err: ErrCallDepth}
+	}
+
+	// struct arguments are passed by value
+	for i := vm.sp - numArgs; i < vm.sp; i++ {
+		value, err := vm.copyStruct(vm.stack[i])
+		if err != nil {
+			return err
+		}
+		vm.stack[i] = value
+	}
+
 	frame := NewFrame(fn, vm.sp-numArgs)
+	err := vm.growStack(frame.basePointer + fn.NumLocals)
+	if err != nil {
+		return &StackOverflowError{Function: fn.Name, Err: ErrStackOverflow}
+	}
+
 	vm.pushFrame(frame)
 	vm.sp = frame.basePointer + fn.NumLocals
 	return nil
@@ -501,7 +1247,10 @@ func (vm *VM) callFunction(fn *object.CompiledFunction, numArgs int) error {
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	result := builtin.Call(vm.runtime, args...)
+	if vm.runtime.OverAllocationLimit() {
+		return ErrMemoryLimit
+	}
 	vm.sp = vm.sp - numArgs - 1
 	if result != nil {
 		vm.push(result)
@@ -1,10 +1,17 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/odas0r/yail/ast"
+	"github.com/odas0r/yail/code"
 	"github.com/odas0r/yail/compiler"
 	"github.com/odas0r/yail/lexer"
 	"github.com/odas0r/yail/object"
@@ -98,6 +105,11 @@ func testExpectedObject(
 		if err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
 	case bool:
 		err := testBooleanObject(expected, actual)
 		if err != nil {
@@ -141,12 +153,15 @@ func testExpectedObject(
 			t.Errorf("wrong error message. expected=%q, got=%q",
 				expected.Message, errObj.Message)
 		}
-	case [][]object.Object:
-		// gotStruct, ok := actual.(*object.Struct)
-		// if !ok {
-		// 	t.Errorf("object is not Struct. got=%T (%+v)", actual, actual)
-		// }
-		// fmt.Println("STRUCT: " + actual.Inspect())
+	case *object.Struct:
+		strct, ok := actual.(*object.Struct)
+		if !ok {
+			t.Errorf("object is not Struct. got=%T (%+v)", actual, actual)
+			return
+		}
+		if strct.Inspect() != expected.Inspect() {
+			t.Errorf("wrong struct. got=%s, want=%s", strct.Inspect(), expected.Inspect())
+		}
 	}
 }
 
@@ -168,6 +183,58 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 // 2", 3},
+		{"-7 // 2", -4},
+		{"2 ** 10", 1024},
+		{"-2 ** 2", -4},
+		{"2 ** 3 ** 2", 512},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+	}
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"7.5 % 2", 1.5},
+		{"7.5 // 2", 3.0},
+		{"2.0 ** 3", 8.0},
+		{"2 ** 0.5 * 2 ** 0.5", 2.0000000000000004},
+		{"-2.5", -2.5},
+		{"-2.5 * -2", 5.0},
+		{"float f = 1.5; -f", -1.5},
+		{"float f = -2.5; f", -2.5},
+	}
+	runVmTests(t, tests)
+}
+
+func TestIntToFloat(t *testing.T) {
+	tests := []vmTestCase{
+		{`float f = 1; f / 2`, 0.5},
+		{`global { float f = 3; } f / 2`, 1.5},
+		{`float f = 0.5; f = 3; f / 2`, 1.5},
+		{`half(float x) float { half = x / 2; } half(3)`, 1.5},
+		{`one() float { one = 1; } one() / 2`, 0.5},
+		{`one() float { return 1; } one() / 2`, 0.5},
+		{`apply(func(float) float f) float { apply = f(3); } half(float x) float { half = x / 2; } apply(half)`, 1.5},
+		{`float a[] = {1, 2.5}; a[0] / 2`, 0.5},
+		{`float a[2]; a[1] = 3; a[1] / 2`, 1.5},
+		{
+			`
+			structs { point2D {float x, y;}; }
+			point2D p = point2D{ x = 1 };
+			p.y = 3;
+			p.x / 2 + p.y / 2
+			`, 2.0,
+		},
 	}
 	runVmTests(t, tests)
 }
@@ -223,359 +290,1539 @@ func TestConditionals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
-func TestStringExpressions(t *testing.T) {
-	tests := []vmTestCase{
-		{`"monkey"`, "monkey"},
-		{`"mon" + "key"`, "monkey"},
-		{`"mon" + "key" + "banana"`, "monkeybanana"},
-	}
-	runVmTests(t, tests)
-}
-
-func TestArrayStatements(t *testing.T) {
+func TestForIn(t *testing.T) {
 	tests := []vmTestCase{
+		{`int s = 0; int a[] = {1, 2, 3}; for (x in a) { s = s + x; } s`, 6},
+		{`int s = 0; int a[] = {5, 6, 7}; for (i, x in a) { s = s + i * x; } s`, 20},
+		{`map[int]int m = {}; int n = 0; for (k in m) { n = n + 1; } n`, 0},
+		{`string r = ""; for (c in "héllo") { r = c; } r`, "o"},
+		{`int n = 0; for (i, c in "héllo") { n = i; } n`, 4},
 		{
 			`
-			global {
-				int v[];
+			map[string]int m = {"a": 1, "b": 2, "c": 3};
+			int s = 0;
+			for (k, v in m) {
+				s = s * 10 + v;
 			}
-			v;
-			`, []int{0},
+			s
+			`, 123,
 		},
 		{
 			`
-			global {
-				int v[] = {1,2,3};
+			map[int]int m = {4: 1, 5: 2};
+			int s = 0;
+			for (k in m) {
+				s = s + k;
 			}
-			v;
-			`, []int{1, 2, 3},
+			s
+			`, 9,
 		},
 		{
 			`
-			global {
-				int v[] = {1+2,3-4,5*6};
+			int s = 0;
+			int a[] = {1, 2, 3, 4, 5};
+			for (x in a) {
+				if (x == 2) { continue; }
+				if (x == 4) { break; }
+				s = s + x;
 			}
-			v;
-			`, []int{3, -1, 30},
+			s
+			`, 4,
 		},
-	}
-	runVmTests(t, tests)
-}
-
-func TestGlobalVarStatement(t *testing.T) {
-	tests := []vmTestCase{
 		{
 			`
-			global {
-				int one = 1;
+			int s = 0;
+			int m[2][2] = {{1, 2}, {3, 4}};
+			for (row in m) {
+				for (x in row) {
+					s = s * 10 + x;
+				}
 			}
-			one;
-			`, 1,
+			s
+			`, 1234,
 		},
 		{
 			`
-			global {
-				int one = 1;
-				int two = 2;
+			sum(int a[]) int {
+				for (x in a) {
+					sum = sum + x;
+				}
 			}
-			one + two;
-			`, 3,
+			int a[] = {1, 2, 3};
+			sum(a) + sum(a)
+			`, 12,
 		},
 		{
 			`
-			global {
-				int one = 1;
-				int two = one + one;
+			int a[] = {1, 2};
+			int n = 0;
+			for (x in a) {
+				if (x == 1) { push(a, 3); }
+				n = n + 1;
 			}
-			one + two;
+			n
 			`, 3,
 		},
+		{
+			`
+			map[int]int m = {1: 1, 2: 2, 3: 3};
+			int n = 0;
+			for (k in m) {
+				delete(m, 3);
+				n = n + 1;
+			}
+			n
+			`, 2,
+		},
 	}
+
 	runVmTests(t, tests)
 }
 
-func TestIndexStatement(t *testing.T) {
+func TestElseIf(t *testing.T) {
 	tests := []vmTestCase{
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (1 > 2) { 20 } else { 30 }", 30},
+		{"if (2 > 1) { 10 } else if (2 > 1) { 20 } else { 30 }", 10},
+		{"if (1 > 2) { 10 } else if (1 > 2) { 20 }", Null},
 		{
 			`
-			global {
-				int v[3] = {1,2,3};
+			grade(int n) int {
+				if (n > 89) {
+					grade = 4;
+				} else if (n > 79) {
+					grade = 3;
+				} else if (n > 69) {
+					grade = 2;
+				} else {
+					grade = 1;
+				}
 			}
-			v[1]
-			`, 2,
+			grade(95) * 1000 + grade(85) * 100 + grade(75) * 10 + grade(5);
+			`, 4321,
 		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSwitch(t *testing.T) {
+	tests := []vmTestCase{
 		{
 			`
-			global {
-				int v[3] = {1,2,3};
+			name(int n) int {
+				switch (n) {
+				case 1: name = 10;
+				case 2, 3: name = 20;
+				case 5: name = 50;
+				default: name = -1;
+				}
 			}
-			v[0 + 2]
-			`, 3,
+			name(1) + name(2) + name(3) + name(5) + name(4) + name(0) + name(9);
+			`, 97,
 		},
 		{
 			`
-			global {
-				int v[];
+			sparse(int n) int {
+				switch (n) {
+				case -100: sparse = 1;
+				case 0: sparse = 2;
+				case 100: sparse = 3;
+				}
 			}
-			v[0]
-			`, 0,
+			sparse(-100) * 100 + sparse(0) * 10 + sparse(100) + sparse(7);
+			`, 123,
 		},
 		{
 			`
-			global {
-				int v[] = {1,2,3};
+			global { string s = "b"; int r = 0; }
+			switch (s) {
+			case "a": r = 1;
+			case "b": r = 2;
+			default: r = 3;
 			}
-			v[99]
-			`, Null,
+			r;
+			`, 2,
 		},
 		{
 			`
-			global {
-				int v[] = {1,2,3};
+			global { int s = 0; }
+			for (i, 1, 6, 1) {
+				switch (i) {
+				case 2: continue;
+				case 4: break;
+				case 6: s = s + 1000;
+				}
+				s = s + i;
 			}
-			v[-1]
-			`, Null,
-		},
-	}
-	runVmTests(t, tests)
-}
-
-// TODO: finish this later
-// func TestStructStatement(t *testing.T) {
-// 	tests := []vmTestCase{
-// 		{
-// 			`
-// 			structs {
-// 				point2D {int x;};
-// 			}
-// 			point2D p;
-// 			`, 0,
-// 		},
-// 		{
-// 			`
-// 			structs {
-// 				circle {int center, int radius;};
-// 				point3D {float x, y, z;};
-// 			}
-// 			circle c;
-// 			`, 0,
-// 		},
-// 	}
-// 	runVmTests(t, tests)
-// }
-
-func TestCallingFunctionsWithoutArguments(t *testing.T) {
-	tests := []vmTestCase{
+			s;
+			`, 1019,
+		},
 		{
 			`
-			add() int {
-				add = 5 + 10;
+			f(int x, int y) int {
+				switch (x) {
+				case 1:
+					switch (y) {
+					case 1: return 11;
+					case 2: return 12;
+					}
+				case 2:
+					return 20;
+				}
+				f = 99;
 			}
-			add();
-			`, 15,
+			f(1, 1) + f(1, 2) + f(1, 3) + f(2, 0) + f(3, 0);
+			`, 241,
 		},
 		{
 			`
-			add() int {
-				add = 5 + 10;
-				# FIXME: DOESN'T WORK
-			  # add = add + 15;
+			far(int n) int {
+				switch (n) {
+				case -4611686018427387904: far = 1;
+				case 4611686018427387904: far = 2;
+				case -9223372036854775807, 9223372036854775807: far = 3;
+				default: far = 4;
+				}
 			}
-			add();
-			`, 15,
+			far(-4611686018427387904) * 1000 + far(4611686018427387904) * 100 +
+				far(9223372036854775807) * 10 + far(0);
+			`, 1234,
 		},
 		{
 			`
-			a() int {
-				a = 1;
-			}
-			b() int {
-				b = a() + 1;
-			}
-			c() int {
-				c = b() + 1;
+			global { float x = 1.0; int r = 0; }
+			switch (x) {
+			case 1: r = 1;
+			case 2: r = 2;
+			default: r = 3;
 			}
-			c();
-			`, 3,
+			r;
+			`, 1,
 		},
 	}
+
 	runVmTests(t, tests)
 }
 
-func TestCallingFunctionsWithoutReturn(t *testing.T) {
+func TestLoops(t *testing.T) {
 	tests := []vmTestCase{
 		{
 			`
-			noReturn() int { }
-			noReturn();
-			`, 0,
-		},
-		{
-			`
-			noReturn() int[] { }
-			noReturn();
-			`, []int{0},
-		},
-		{
-			`
-			noReturn() int { }
-			noReturnTwo() int { noReturnTwo = noReturn(); }
-			noReturn();
-			noReturnTwo();
-			`, 0,
+			global { int i = 0; }
+			while (i < 5) { i = i + 1; }
+			i;
+			`, 5,
 		},
 		{
 			`
-			noReturn() bool { }
-			noReturnTwo() int { noReturnTwo = noReturn(); }
-			noReturn();
-			noReturnTwo();
-			`, false,
+			global { int s = 0; int i = 0; }
+			while (true) {
+				i = i + 1;
+				if (i > 10) { break; }
+				if (i == 3) { continue; }
+				s = s + i;
+			}
+			s;
+			`, 52,
 		},
 		{
 			`
-			noReturn() float { }
-			noReturnTwo() int { noReturnTwo = noReturn(); }
-			noReturn();
-			noReturnTwo();
-			`, 0.0,
+			global { int s = 0; }
+			for (i, 1, 10, 1) {
+				if (i == 5) { continue; }
+				s = s + i;
+			}
+			s;
+			`, 50,
 		},
-	}
-	runVmTests(t, tests)
-}
-
-func TestCallingFunctionsWithBindings(t *testing.T) {
-	tests := []vmTestCase{
-
 		{
 			`
-			wow() int {
-				local {
-					int a = 30;
-					int b = 30;
-				}
-				wow = a + b;
+			global { int s = 0; }
+			for (i, 10, 1, -1) {
+				if (i < 8) { break; }
+				s = s * 100 + i;
 			}
-			wow();
-			`, 60,
+			s;
+			`, 100908,
 		},
 		{
 			`
-			oneAndTwo() int {
-				local {
-					int one = 1;
-					int two = 2;
-				}
-				oneAndTwo = one + two;
-			}
-			threeAndFour() int {
-				local {
-					int three = 3;
-					int four = 4;
-				}
-				threeAndFour = three + four;
+			global { int r = 0; int s = -1; }
+			for (i, 10, 1, s) {
+				r = r * 10 + i % 10;
 			}
-			oneAndTwo() + threeAndFour();
-			`, 10,
+			r;
+			`, 987654321,
 		},
 		{
 			`
-			global {
-				int globalSeed = 50;
-			}
-
-			minusOne() int {
-				local {
-					int num = 1;
-				}
-				minusOne = globalSeed - num;
-			}
-
-			minusTwo() int {
-				local {
-					int num = 2;
-				}
-				minusTwo = globalSeed - num;
+			global { int s = 0; int a = 1; int b = 3; }
+			for (i, b * 3, a, a - b) {
+				s = s * 10 + i;
 			}
-			minusOne() + minusTwo();
-			`, 97,
+			s;
+			`, 97531,
 		},
-	}
-	runVmTests(t, tests)
-}
-
-func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
-	tests := []vmTestCase{
 		{
 			`
-			identity(int a) int {
-				identity = a;
+			global { int s = 0; int step = 2; }
+			for (i, 1, 7, step) {
+				s = s * 10 + i;
 			}
-			identity(4);
-			`, 4,
+			s;
+			`, 1357,
 		},
 		{
 			`
-			sum(int a,b) int {
-				sum = a+b;
+			global { int s = 0; int step = -1; }
+			for (i, 1, 3, step) {
+				s = s + 1;
 			}
-			sum(1,2);
-			`, 3,
+			s;
+			`, 0,
 		},
 		{
 			`
-			sum(int a,b) int {
-				local {
-					int result = a + b;
+			global { int s = 0; }
+			for (i, 1, 3, 1) {
+				for (j, 1, 3, 1) {
+					if (j > i) { break; }
+					s = s + 1;
 				}
-				sum = result;
 			}
-			sum(1,2) + sum(3,4);
-			`, 10,
+			s;
+			`, 6,
 		},
 		{
 			`
-			sum(int a,b) int {
-				local {
-					int result = a + b;
+			sum(int n) int {
+				for (i, 1, n, 1) {
+					if (i > 100) { break; }
+					sum = sum + i;
 				}
-				sum = result;
-			}
-			outer() int {
-				outer = sum(1,2) + sum(3,4);
 			}
-			outer();
-			`, 10,
+			sum(10);
+			`, 55,
 		},
 		{
 			`
-			global {
-				int globalNum = 10;
-			}
-
-			sum(int a,b) int {
-				local {
-					int result = a + b;
+			find(int x) int {
+				local { int i = 0; }
+				find = -1;
+				while (i < 10) {
+					if (i * i == x) { return i; }
+					i = i + 1;
 				}
-				sum = result + globalNum;
-			}
-			outer() int {
-				outer = sum(1,2) + sum(3,4) + globalNum;
 			}
-			outer() + globalNum;
-			`, 50,
+			find(49) * 10 + find(50);
+			`, 69,
 		},
 	}
+
 	runVmTests(t, tests)
 }
 
-func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+func TestStringExpressions(t *testing.T) {
 	tests := []vmTestCase{
-		{
-			`
-			a() int {
-				a = 1;
-			}
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`string s; len(s)`, 0},
+		{`string s = "yail"; s[1]`, "a"},
+		{`string s = "héllo"; s[1] + s[4]`, "éo"},
+		{`string s = "héllo"; len(s)`, 5},
+		{`string s = "héllo"; s[1:3]`, "él"},
+		{`string s = "yail"; s[:2] + s[2:]`, "yail"},
+		{`string s = "yail"; s[:]`, "yail"},
+		{`int a[] = {1, 2, 3, 4}; a[1:3]`, []int{2, 3}},
+		{`int a[] = {1, 2, 3}; int b[] = a[:2]; b[0] = 9; a`, []int{1, 2, 3}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestConversions(t *testing.T) {
+	tests := []vmTestCase{
+		{`int(3.9)`, 3},
+		{`int(-3.9)`, -3},
+		{`int(true)`, 1},
+		{`int(" 42 ")`, 42},
+		{`float w = 2.5; int n = 1 + int(w); n`, 3},
+		{`float(2)`, 2.0},
+		{`float("1.5")`, 1.5},
+		{`float(false)`, 0.0},
+		{`bool(0)`, false},
+		{`bool(0.5)`, true},
+		{`bool("true")`, true},
+		{`string(42)`, "42"},
+		{`string(2.0)`, "2.0"},
+		{`string(1 < 2)`, "true"},
+		{`string s = "n = " + string(7); s`, "n = 7"},
+		{`int("4x")`, &object.Error{Message: `cannot convert "4x" to int`}},
+		{`float("x")`, &object.Error{Message: `cannot convert "x" to float`}},
+		{`bool("yes")`, &object.Error{Message: `cannot convert "yes" to bool`}},
+		{`int(-9223372036854775808.0)`, -9223372036854775808},
+		{`int(9223372036854775807.0)`, &object.Error{Message: `cannot convert 9223372036854776000.0 to int`}},
+		{`int(-9223372036854777856.0)`, &object.Error{Message: `cannot convert -9223372036854778000.0 to int`}},
+		{`int(INF)`, &object.Error{Message: `cannot convert +Inf to int`}},
+		{`int(-INF)`, &object.Error{Message: `cannot convert -Inf to int`}},
+		{`int(NAN)`, &object.Error{Message: `cannot convert NaN to int`}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`abs(-3)`, 3},
+		{`abs(-2.5)`, 2.5},
+		{`min(3, 1, 2)`, 1},
+		{`max(3, 1, 2)`, 3},
+		{`max(1, 2.5)`, 2.5},
+		{`max(9007199254740993, 9007199254740992)`, 9007199254740993},
+		{`min(-9007199254740993, -9007199254740992)`, -9007199254740993},
+		{`abs(-9223372036854775807 - 1)`, &object.Error{Message: "integer overflow: abs(-9223372036854775808)"}},
+		{`floor(2.7)`, 2.0},
+		{`ceil(2.2)`, 3.0},
+		{`round(2.5)`, 3.0},
+		{`trunc(-2.7)`, -2.0},
+		{`floor(-2.5)`, -3.0},
+		{`floor(7)`, 7},
+		{`sin(0)`, 0.0},
+		{`cos(0)`, 1.0},
+		{`exp(0)`, 1.0},
+		{`log2(8)`, 3.0},
+		{`log10(1000)`, 3.0},
+		{`hypot(3, 4)`, 5.0},
+		{`pow(2, 10)`, 1024},
+		{`pow(2, -1)`, 0.5},
+		{`pow(2, 62)`, 4611686018427387904},
+		{`pow(-2, 63)`, -9223372036854775807 - 1},
+		{`pow(2, 63)`, &object.Error{Message: "integer overflow: pow(2, 63)"}},
+		{`pow(3, 100)`, &object.Error{Message: "integer overflow: pow(3, 100)"}},
+		{`mod(7, 3)`, 1},
+		{`mod(-7, 3)`, 2},
+		{`mod(7, -3)`, -2},
+		{`div(-7, 3)`, -3},
+		{`div(7, 2)`, 3},
+		{`floor(PI)`, 3.0},
+		{`is_nan(NAN)`, true},
+		{`is_inf(INF)`, true},
+		{`is_inf(E)`, false},
+		{`float PI = 3.0; PI`, 3.0},
+		{`mod(1, 0)`, &object.Error{Message: "division by zero"}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestRandomBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`int n = rand_int(3, 5); min(max(n, 3), 5) == n`, true},
+		{`rand_int(4, 4)`, 4},
+		{`int(floor(rand_float()))`, 0},
+		{`int a[] = {1, 2, 3, 4}; shuffle(a); len(a) * 10 + a[0] + a[1] + a[2] + a[3]`, 50},
+		{`rand_int(2, 1)`, &object.Error{Message: "empty range for 'rand_int': [2, 1]"}},
+	}
+	runVmTests(t, tests)
+
+	// the generator belongs to each VM: seeding one and drawing from it between
+	// the draws of another doesn't change the numbers of the other
+	var other func()
+	r := object.Builtins.Copy()
+	err := r.Register(&object.Builtin{ID: object.FirstHostID, Name: "other",
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			other()
+			return nil
+		}})
+	if err != nil {
+		t.Fatalf("register error: %s", err)
+	}
+
+	run := func(seed int) string {
+		input := fmt.Sprintf(`
+		seed(%d);
+		int a[] = {1, 2, 3, 4, 5, 6, 7, 8};
+		shuffle(a);
+		other();
+		push(a, rand_int(0, 1000000));
+		a
+		`, seed)
+		comp := compiler.NewWithBuiltins(r)
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		vm.UseBuiltins(r)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		return vm.LastPoppedStackElem().Inspect()
+	}
+
+	noop := func() {}
+	other = noop
+	first, second := run(42), run(7)
+	if first == second {
+		t.Fatalf("runs with different seeds are the same: %s", first)
+	}
+
+	var interleaved string
+	other = func() {
+		other = noop
+		interleaved = run(7)
+	}
+	if got := run(42); got != first {
+		t.Fatalf("draws of another VM changed the numbers: want=%s, got=%s", first, got)
+	}
+	if interleaved != second {
+		t.Fatalf("runs with the same seed differ: %s and %s", second, interleaved)
+	}
+
+	// the widest ranges don't overflow
+	wide := []vmTestCase{}
+	for i := 0; i < 100; i++ {
+		wide = append(wide,
+			vmTestCase{`rand_int(0, 9223372036854775807) > -1`, true},
+			vmTestCase{`rand_int(-9223372036854775807 - 1, 0) < 1`, true},
+			vmTestCase{`rand_int(-1, 9223372036854775807) > -2`, true},
+			vmTestCase{`int n = rand_int(-9223372036854775807 - 1, 9223372036854775807); true`, true},
+		)
+	}
+	runVmTests(t, wide)
+}
+
+func TestInputOutput(t *testing.T) {
+	input := `
+	string name = trim(read());
+	int v[2];
+	read_all(v);
+	write("hello", name);
+	write(v[0] + v[1]);
+	`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	vm := New(comp.Bytecode())
+	vm.SetIO(strings.NewReader("yail\n3\n4\n"), &out)
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := "v[0]: v[1]: hello yail\n7\n"
+	if out.String() != expected {
+		t.Fatalf("wrong output: want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`split("a,b,c", ",")`, []string{"a", "b", "c"}},
+		{`string parts[] = {"a", "b"}; join(parts, "-")`, "a-b"},
+		{`trim("  yail ")`, "yail"},
+		{`upper("yail")`, "YAIL"},
+		{`lower("YaIl")`, "yail"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`find("héllo", "l")`, 2},
+		{`find("yail", "x")`, -1},
+		{`starts_with("yail", "ya")`, true},
+		{`starts_with("yail", "il")`, false},
+		{`to_chars("hé")`, []int{104, 233}},
+		{`from_chars(to_chars("yail"))`, "yail"},
+		{`join({"a", 1}, ",")`, &object.Error{Message: "argument 1 to 'join' must be string[], got array"}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestArrayStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			global {
+				int v[];
+			}
+			v;
+			`, []int{0},
+		},
+		{
+			`
+			global {
+				int v[] = {1,2,3};
+			}
+			v;
+			`, []int{1, 2, 3},
+		},
+		{
+			`
+			global {
+				int v[] = {1+2,3-4,5*6};
+			}
+			v;
+			`, []int{3, -1, 30},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestGlobalVarStatement(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			global {
+				int one = 1;
+			}
+			one;
+			`, 1,
+		},
+		{
+			`
+			global {
+				int one = 1;
+				int two = 2;
+			}
+			one + two;
+			`, 3,
+		},
+		{
+			`
+			global {
+				int one = 1;
+				int two = one + one;
+			}
+			one + two;
+			`, 3,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestIndexStatement(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			global {
+				int v[3] = {1,2,3};
+			}
+			v[1]
+			`, 2,
+		},
+		{
+			`
+			global {
+				int v[3] = {1,2,3};
+			}
+			v[0 + 2]
+			`, 3,
+		},
+		{
+			`
+			global {
+				int v[];
+			}
+			v[0]
+			`, 0,
+		},
+		{
+			`
+			int v[5];
+			v[4] = 2;
+			v
+			`, []int{0, 0, 0, 0, 2},
+		},
+		{
+			`
+			int v[3] = {};
+			v
+			`, []int{0, 0, 0},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestMultiDimensionalArrays(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			float m[2][3];
+			len(m) * 10 + len(m[1])
+			`, 23,
+		},
+		{
+			`
+			int m[2][2] = {{1, 2}, {3, 4}};
+			m[1][0] * 10 + m[0][1]
+			`, 32,
+		},
+		{
+			`
+			int m[3][3];
+			for (i, 0, 2, 1) {
+				for (j, 0, 2, 1) {
+					m[i][j] = i * 3 + j;
+				}
+			}
+			m[2]
+			`, []int{6, 7, 8},
+		},
+		{
+			`
+			int m[2][2] = {{1, 2}, {3, 4}};
+			m[0] = {5, 6};
+			m[0][1] + m[1][1]
+			`, 10,
+		},
+		{
+			`
+			int c[2][3][4];
+			len(c, 0) * 100 + len(c, 1) * 10 + len(c, 2)
+			`, 234,
+		},
+		{
+			`
+			int m[2][2];
+			len(m, 2)
+			`, &object.Error{Message: "array has no dimension 2"},
+		},
+		{
+			`
+			trace(int m[][]) int {
+				trace = m[0][0] + m[1][1];
+			}
+			trace({{1, 2}, {3, 4}})
+			`, 5,
+		},
+		{
+			`
+			identity() int[][] {
+				identity = {{1, 0}, {0, 1}};
+			}
+			identity()[1]
+			`, []int{0, 1},
+		},
+	}
+	runVmTests(t, tests)
+
+	// arrays larger than the operand of OpArray are filled with copies of
+	// a single element
+	runVmTests(t, []vmTestCase{
+		{`int a[65535]; len(a)`, 65535},
+		{`int a[65536]; len(a)`, 65536},
+		{`int a[70000]; a[69999] = 7; len(a) + a[69999]`, 70007},
+		{`int a[65536]; float f = 2.5; f`, 2.5},
+		{`int m[300][300]; m[0][0] = 1; m[0][0] * 10 + m[1][0] + len(m) * len(m[299])`, 90010},
+	})
+
+}
+
+func TestArrayBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`int a[] = {1, 2}; push(a, 3); a`, []int{1, 2, 3}},
+		{`int a[] = {1, 2, 3}; pop(a) * 10 + len(a)`, 32},
+		{`int a[] = {1, 3}; insert(a, 1, 2); a`, []int{1, 2, 3}},
+		{`int a[] = {1, 3}; insert(a, 2, 5); a`, []int{1, 3, 5}},
+		{`int a[] = {1, 2, 3}; remove(a, 0) * 10 + len(a)`, 12},
+		{`int a[] = {1, 2, 3, 4}; slice(a, 1, 3)`, []int{2, 3}},
+		{`int a[] = {1, 2, 3}; int b[] = slice(a, 0, 1); a`, []int{1, 2, 3}},
+		{`int a[] = {1, 2}; int b[] = {3}; concat(a, b)`, []int{1, 2, 3}},
+		{`int a[] = {1, 2, 3}; reverse(a)`, []int{3, 2, 1}},
+		{`int a[] = {1, 2, 3}; int b[] = reverse(a); a`, []int{1, 2, 3}},
+		{`int a[] = {1, 2, 3}; contains(a, 2)`, true},
+		{`int a[] = {1, 2, 3}; contains(a, 4)`, false},
+		{`int a[] = {1, 2, 3}; index_of(a, 3)`, 2},
+		{`int a[] = {1, 2, 3}; index_of(a, 7)`, -1},
+		{`string s[] = {"a", "b"}; index_of(s, "b")`, 1},
+		{
+			`
+			structs { point { int x; }; }
+			point ps[] = {point{x = 1}};
+			point p = point{x = 2};
+			push(ps, p);
+			p.x = 5;
+			ps[1].x * 10 + index_of(ps, point{x = 1})
+			`, 20,
+		},
+		{
+			`
+			fill(int a[], int n) int {
+				for (i, 1, n, 1) {
+					push(a, i);
+				}
+				fill = len(a);
+			}
+			int a[] = {};
+			fill(a, 3) * 10 + a[2]
+			`, 33,
+		},
+		{`int a[] = {}; len(a)`, 0},
+		{`int a[] = {}; a`, []int{}},
+		{`int a[] = {}; pop(a)`, &object.Error{Message: "pop from empty array"}},
+		{`int a[] = {1}; remove(a, 1)`, &object.Error{Message: "index out of range: 1 (length 1)"}},
+		{`int a[] = {1}; insert(a, -1, 0)`, &object.Error{Message: "index out of range: -1 (length 1)"}},
+		{`int a[] = {1, 2}; slice(a, 1, 3)`, &object.Error{Message: "slice bounds out of range: [1:3] (length 2)"}},
+		{`int a[] = {1, 2, 3}; int b[] = slice(a, 1, 3); push(b, 4); b`, []int{2, 3, 4}},
+		{`int a[] = {1}; a = {1, 2}; a`, []int{1, 2}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestMaps(t *testing.T) {
+	tests := []vmTestCase{
+		{`map[string]int m = {"a": 1, "b": 2}; m["b"]`, 2},
+		{`map[string]int m; m["a"] = 5; m["a"] + len(m)`, 6},
+		{`map[string]int m = {}; len(m)`, 0},
+		{`map[int]string m = {1: "one"}; m[1] = "uno"; m[1]`, "uno"},
+		{`map[bool]int m = {true: 1, false: 0}; m[1 > 0]`, 1},
+		{`map[int]int m = {3: 30, 1: 10, 2: 20}; keys(m)`, []int{3, 1, 2}},
+		{`map[int]int m = {3: 30, 1: 10}; m[3] = 33; values(m)`, []int{33, 10}},
+		{`map[string]int m = {"a": 1}; has(m, "a")`, true},
+		{`map[string]int m = {"a": 1}; delete(m, "a"); has(m, "a")`, false},
+		{`map[int]int m = {1: 1, 2: 2, 3: 3}; delete(m, 2); keys(m)`, []int{1, 3}},
+		{`map[string]int m = {"a": 1}; m = {"b": 2, "c": 3}; len(m)`, 2},
+		{
+			`
+			count(int xs[]) map[int]int {
+				map[int]int seen;
+				for (i, 0, len(xs) - 1, 1) {
+					if (has(seen, xs[i])) {
+						seen[xs[i]] = seen[xs[i]] + 1;
+					} else {
+						seen[xs[i]] = 1;
+					}
+				}
+				count = seen;
+			}
+			int xs[] = {1, 2, 1, 3, 1};
+			count(xs)[1]
+			`, 3,
+		},
+		{
+			`
+			structs { inventory { map[string]int stock; }; }
+			inventory a;
+			a.stock["apple"] = 3;
+			inventory b = a;
+			b.stock["apple"] = 5;
+			a.stock["apple"]
+			`, 3,
+		},
+		{`map[string]int m; delete(m, {1})`, &object.Error{Message: "unusable as map key: ARRAY"}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestStructStatements(t *testing.T) {
+	point2D := &object.StructType{
+		Name:   "point2D",
+		Fields: []object.StructField{{Name: "x"}, {Name: "y"}},
+	}
+
+	tests := []vmTestCase{
+		{
+			`
+			structs {
+				point2D {float x, y;};
+			}
+			point2D p;
+			p;
+			`,
+			&object.Struct{StructType: point2D, Attributes: map[string]object.Object{
+				"x": &object.Float{Value: 0},
+				"y": &object.Float{Value: 0},
+			}},
+		},
+		{
+			`
+			structs {
+				point2D {float x, y;};
+			}
+			global {
+				point2D p;
+			}
+			p.y = 2.5;
+			p;
+			`,
+			&object.Struct{StructType: point2D, Attributes: map[string]object.Object{
+				"x": &object.Float{Value: 0},
+				"y": &object.Float{Value: 2.5},
+			}},
+		},
+		{
+			`
+			structs {
+				circle {int center, int radius;};
+			}
+			circle c;
+			c.radius = 5;
+			c.radius;
+			`, 5,
+		},
+		{
+			`
+			structs {
+				circle {int center, int radius;};
+			}
+			circle a;
+			circle b;
+			a.radius = 1;
+			b.radius;
+			`, 0,
+		},
+		{
+			`
+			structs {
+				circle {int center, int radius;};
+			}
+			circle a;
+			circle b;
+			a.radius = 1;
+			b = a;
+			b.radius = 2;
+			a.radius * 10 + b.radius;
+			`, 12,
+		},
+		{
+			`
+			structs {
+				circle {int center, int radius;};
+			}
+			global { int s = 0; }
+			for (i, 1, 3, 1) {
+				circle c;
+				c.radius = c.radius + i;
+				s = s + c.radius;
+			}
+			s;
+			`, 6,
+		},
+		{
+			`
+			structs {
+				counter {int v[2];};
+			}
+			global { counter a; counter b; }
+			b = a;
+			b.v;
+			`, []int{0, 0},
+		},
+		{
+			`
+			structs {
+				flag {bool on;};
+			}
+			flag f;
+			!f.on == (f.on == false);
+			`, true,
+		},
+		{
+			`
+			structs {
+				circle {int center, int radius;};
+			}
+			grow(circle c) int {
+				c.radius = c.radius + 10;
+				grow = c.radius;
+			}
+			circle a;
+			a.radius = 1;
+			grow(a) * 100 + a.radius;
+			`, 1101,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestStructLiterals(t *testing.T) {
+	point2D := &object.StructType{
+		Name:   "point2D",
+		Fields: []object.StructField{{Name: "x"}, {Name: "y"}},
+	}
+
+	tests := []vmTestCase{
+		{
+			`
+			structs {
+				point2D {float x, y;};
+			}
+			point2D{ x = 1.5, y = 2.0 };
+			`,
+			&object.Struct{StructType: point2D, Attributes: map[string]object.Object{
+				"x": &object.Float{Value: 1.5},
+				"y": &object.Float{Value: 2},
+			}},
+		},
+		{
+			`
+			structs {
+				point2D {float x, y;};
+			}
+			point2D{ y = 3.0 };
+			`,
+			&object.Struct{StructType: point2D, Attributes: map[string]object.Object{
+				"x": &object.Float{Value: 0},
+				"y": &object.Float{Value: 3},
+			}},
+		},
+		{
+			`
+			structs {
+				size {int w, h;};
+			}
+			area(size s) int { area = s.w * s.h; }
+			area(size{ w = 3, h = 4 });
+			`, 12,
+		},
+		{
+			`
+			structs {
+				size {int w, h;};
+			}
+			square(int n) size { square = size{ w = n, h = n }; }
+			square(5).h;
+			`, 5,
+		},
+		{
+			`
+			structs {
+				size {int w, h;};
+			}
+			grow(size s, int n) size {
+				s.w = s.w + n;
+				s.h = s.h + n;
+				return s;
+			}
+			global {
+				size a = size{ w = 1, h = 2 };
+				size b = grow(a, 10);
+			}
+			a.w * 1000 + a.h * 100 + b.w + b.h;
+			`, 1223,
+		},
+		{
+			`
+			structs {
+				size {int w, h;};
+			}
+			empty() size { }
+			empty().w + empty().h;
+			`, 0,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestNestedStructs(t *testing.T) {
+	structs := `
+	structs {
+		point {int x, y;};
+		line {point a, b;};
+		polygon {point pts[3], int n;};
+	}
+	`
+
+	tests := []vmTestCase{
+		{
+			structs + `
+			line l;
+			l.b.y = 5;
+			l.a.y * 10 + l.b.y;
+			`, 5,
+		},
+		{
+			structs + `
+			line l;
+			line m;
+			l.a.x = 1;
+			m.a.x;
+			`, 0,
+		},
+		{
+			structs + `
+			line l;
+			point p;
+			p = l.a;
+			p.x = 9;
+			l.a.x;
+			`, 0,
+		},
+		{
+			structs + `
+			line l;
+			l.a = point{ x = 3, y = 4 };
+			l.a.x + l.a.y;
+			`, 7,
+		},
+		{
+			structs + `
+			line l = line{ b = point{ y = 2 } };
+			l.b.y;
+			`, 2,
+		},
+		{
+			structs + `
+			point ps[5];
+			ps[3].x = 1;
+			ps[3].x + ps[2].x + ps[4].y;
+			`, 1,
+		},
+		{
+			structs + `
+			point ps[3];
+			point p = point{ x = 7 };
+			ps[1] = p;
+			p.x = 0;
+			ps[1].x;
+			`, 7,
+		},
+		{
+			structs + `
+			global {
+				point ps[3];
+			}
+			for (i, 0, 2, 1) {
+				ps[i].x = i * 10;
+			}
+			ps[0].x + ps[1].x + ps[2].x;
+			`, 30,
+		},
+		{
+			structs + `
+			polygon g;
+			polygon h;
+			g.pts[2].y = 4;
+			h = g;
+			h.pts[2].y = 100;
+			g.pts[2].y + g.pts[0].y;
+			`, 4,
+		},
+		{
+			structs + `
+			sum(polygon g) int {
+				for (i, 0, 2, 1) {
+					sum = sum + g.pts[i].x;
+				}
+			}
+			polygon g;
+			g.pts[0].x = 1;
+			g.pts[1].x = 2;
+			g.pts[2].x = 3;
+			sum(g);
+			`, 6,
+		},
+		{
+			`
+			int v[3];
+			v[1] = 5;
+			v;
+			`, []int{0, 5, 0},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithoutArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			add() int {
+				add = 5 + 10;
+			}
+			add();
+			`, 15,
+		},
+		{
+			`
+			add() int {
+				add = 5 + 10;
+				add = add + 15;
+			}
+			add();
+			`, 30,
+		},
+		{
+			`
+			a() int {
+				a = 1;
+			}
+			b() int {
+				b = a() + 1;
+			}
+			c() int {
+				c = b() + 1;
+			}
+			c();
+			`, 3,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithoutReturn(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			noReturn() int { }
+			noReturn();
+			`, 0,
+		},
+		{
+			`
+			noReturn() int[] { }
+			noReturn();
+			`, []int{},
+		},
+		{
+			`
+			pair() int[] { push(pair, 1); push(pair, 2); }
+			pair();
+			`, []int{1, 2},
+		},
+		{
+			`
+			noReturn() int { }
+			noReturnTwo() int { noReturnTwo = noReturn(); }
+			noReturn();
+			noReturnTwo();
+			`, 0,
+		},
+		{
+			`
+			noReturn() bool { }
+			noReturnTwo() bool { noReturnTwo = noReturn(); }
+			noReturn();
+			noReturnTwo();
+			`, false,
+		},
+		{
+			`
+			noReturn() float { }
+			noReturnTwo() float { noReturnTwo = noReturn(); }
+			noReturn();
+			noReturnTwo();
+			`, 0.0,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+
+		{
+			`
+			wow() int {
+				local {
+					int a = 30;
+					int b = 30;
+				}
+				wow = a + b;
+			}
+			wow();
+			`, 60,
+		},
+		{
+			`
+			oneAndTwo() int {
+				local {
+					int one = 1;
+					int two = 2;
+				}
+				oneAndTwo = one + two;
+			}
+			threeAndFour() int {
+				local {
+					int three = 3;
+					int four = 4;
+				}
+				threeAndFour = three + four;
+			}
+			oneAndTwo() + threeAndFour();
+			`, 10,
+		},
+		{
+			`
+			global {
+				int globalSeed = 50;
+			}
+
+			minusOne() int {
+				local {
+					int num = 1;
+				}
+				minusOne = globalSeed - num;
+			}
+
+			minusTwo() int {
+				local {
+					int num = 2;
+				}
+				minusTwo = globalSeed - num;
+			}
+			minusOne() + minusTwo();
+			`, 97,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			identity(int a) int {
+				identity = a;
+			}
+			identity(4);
+			`, 4,
+		},
+		{
+			`
+			sum(int a,b) int {
+				sum = a+b;
+			}
+			sum(1,2);
+			`, 3,
+		},
+		{
+			`
+			sum(int a,b) int {
+				local {
+					int result = a + b;
+				}
+				sum = result;
+			}
+			sum(1,2) + sum(3,4);
+			`, 10,
+		},
+		{
+			`
+			sum(int a,b) int {
+				local {
+					int result = a + b;
+				}
+				sum = result;
+			}
+			outer() int {
+				outer = sum(1,2) + sum(3,4);
+			}
+			outer();
+			`, 10,
+		},
+		{
+			`
+			global {
+				int globalNum = 10;
+			}
+
+			sum(int a,b) int {
+				local {
+					int result = a + b;
+				}
+				sum = result + globalNum;
+			}
+			outer() int {
+				outer = sum(1,2) + sum(3,4) + globalNum;
+			}
+			outer() + globalNum;
+			`, 50,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			abs(int x) int {
+				if (x < 0) {
+					return -x;
+				}
+				return x;
+			}
+			abs(-5) + abs(3);
+			`, 8,
+		},
+		{
+			`
+			fact(int n) int {
+				fact = 1;
+				if (n > 1) {
+					fact = n * fact(n - 1);
+				}
+			}
+			fact(5);
+			`, 120,
+		},
+		{
+			`
+			early() int {
+				early = 7;
+				return;
+				early = 8;
+			}
+			early();
+			`, 7,
+		},
+		{
+			`
+			sign(int x) int {
+				if (x > 0) {
+					return 1;
+				} else {
+					if (x < 0) {
+						return -1;
+					}
+				}
+			}
+			sign(10) * 100 + sign(-10) * 10 + sign(0);
+			`, 90,
+		},
+		{
+			`
+			global {
+				int x = 1;
+			}
+			if (x > 0) { x = 5; }
+			x;
+			`, 5,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			fib(int n) int {
+				fib = if (n < 2) { n } else { fib(n - 1) + fib(n - 2) };
+			}
+			fib(15);
+			`, 610,
+		},
+		{
+			`
+			isEven(int n) bool {
+				isEven = if (n == 0) { true } else { isOdd(n - 1) };
+			}
+			isOdd(int n) bool {
+				isOdd = if (n == 0) { false } else { isEven(n - 1) };
+			}
+			isEven(10);
+			`, true,
+		},
+		{
+			`
+			isEven(int n) bool {
+				isEven = if (n == 0) { true } else { isOdd(n - 1) };
+			}
+			isOdd(int n) bool {
+				isOdd = if (n == 0) { false } else { isEven(n - 1) };
+			}
+			isOdd(10);
+			`, false,
+		},
+		{
+			`
+			first() int {
+				first = second() + 1;
+			}
+			second() int {
+				second = 41;
+			}
+			first();
+			`, 42,
+		},
+		{
+			`
+			sumTo(int n) int {
+				fact(int k) int {
+					fact = if (k < 2) { 1 } else { k * fact(k - 1) };
+				}
+				sumTo = fact(n) + n;
+			}
+			sumTo(5);
+			`, 125,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestFunctionValues(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			double(int x) int { double = x * 2; }
+			apply(func(int) int f, int x) int { apply = f(x); }
+			apply(double, 21);
+			`, 42,
+		},
+		{
+			`
+			inc(int x) int { inc = x + 1; }
+			dec(int x) int { dec = x - 1; }
+			pick(bool up) func(int) int {
+				pick = if (up) { inc } else { dec };
+			}
+			pick(true)(10) + pick(false)(10) * 100;
+			`, 911,
+		},
+		{
+			`
+			square(int x) int { square = x * x; }
+			sumOf(int a[], func(int) int f, int i) int {
+				sumOf = if (i == len(a)) { 0 } else { f(a[i]) + sumOf(a, f, i + 1) };
+			}
+			global {
+				int v[] = {1, 2, 3};
+			}
+			sumOf(v, square, 0);
+			`, 14,
+		},
+		{
+			`
+			triple(int x) int { triple = x * 3; }
+			run() int {
+				local {
+					func(int) int g = triple;
+				}
+				run = g(5);
+			}
+			run();
+			`, 15,
+		},
+		{
+			`
+			count(func(int[]) int f, int a[]) int { count = f(a); }
+			global {
+				int v[] = {1, 2, 3, 4};
+			}
+			count(len, v);
+			`, 4,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+			a() int {
+				a = 1;
+			}
 			a(1);
 			`, "wrong number of arguments: want=0, got=1",
 		},
@@ -595,7 +1842,225 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 			a(1));
 			`, "wrong number of arguments: want=2, got=1",
 		},
+		{
+			`
+			int v[2];
+			v[5] = 1;
+			`, "index out of range: 5 (length 2)",
+		},
+		{
+			`
+			global {
+				int v[] = {1,2,3};
+			}
+			v[99]
+			`, "index out of range: 99 (length 3)",
+		},
+		{
+			`
+			global {
+				int v[] = {1,2,3};
+			}
+			v[-1]
+			`, "index out of range: -1 (length 3)",
+		},
+		{
+			`
+			structs { line { int xs[2]; }; }
+			line l;
+			l.xs[2]
+			`, "index out of range: 2 (length 2)",
+		},
+		{
+			`
+			int m[2][2];
+			m[1][2] = 1;
+			`, "index out of range: 2 (length 2)",
+		},
+		{
+			`
+			map[string]int m = {"a": 1};
+			m["b"]
+			`, "key not found: b",
+		},
+		{
+			`
+			int n = 3;
+			for (x in n) { }
+			`, "cannot iterate over INTEGER",
+		},
+		{`string s = "yail"; s[4]`, "index out of range: 4 (length 4)"},
+		{`string s = "yail"; s[3:1]`, "slice bounds out of range: [3:1] (length 4)"},
+		{`2 ** -1`, "negative exponent for integer power: -1"},
+		{`1 << -1`, "negative shift count: -1"},
+		{`1.5 & 1`, "unsupported operator for FLOAT: OpBitAnd"},
+		{`~1.5`, "unsupported type for bitwise not: FLOAT"},
+		{`1 / 0`, "division by zero"},
+		{`int n = 0; 7 % n`, "division by zero"},
+		{`7 // 0`, "division by zero"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`9223372036854775807 + 1`, "integer overflow: 9223372036854775807 + 1"},
+		{`-9223372036854775807 - 2`, "integer overflow: -9223372036854775807 - 2"},
+		{`4611686018427387904 * 2`, "integer overflow: 4611686018427387904 * 2"},
+		{`2 ** 63`, "integer overflow: 2 ** 63"},
+		{`1 << 63`, "integer overflow: 1 << 63"},
+		{`int n = -9223372036854775807 - 1; -n`, "integer overflow: -(-9223372036854775808)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		// the overflow wraps around unless the arithmetic is checked
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		vm = New(comp.Bytecode())
+		vm.CheckArithmetic(true)
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+
+	runVmTests(t, []vmTestCase{{`2 ** 62 + (2 ** 62 - 1)`, 9223372036854775807}})
+
+	// the integer builtins return an error instead of wrapping around
+	comp := compiler.New()
+	err := comp.Compile(parse(`div(-9223372036854775807 - 1, -1)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	for _, checked := range []bool{false, true} {
+		vm := New(comp.Bytecode())
+		vm.CheckArithmetic(checked)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		var expected interface{} = -9223372036854775807 - 1
+		if checked {
+			expected = &object.Error{Message: "integer overflow: div(-9223372036854775808, -1)"}
+		}
+		testExpectedObject(t, expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected error
+	}{
+		{`while (true) { }`, Limits{MaxInstructions: 1000}, ErrInstructionLimit},
+		{`f(int n) int { f = f(n + 1); } f(0);`, Limits{MaxCallDepth: 100}, ErrCallDepth},
+		{`gen(1, 1000000000)`, Limits{MaxAllocations: 1000}, ErrMemoryLimit},
+		{`int a[] = {1}; gen(0, 9223372036854775807)`, Limits{MaxAllocations: 1000}, ErrMemoryLimit},
+		// new structs and their copies count the values they hold
+		{`structs { big { int x[60000]; }; } for (i, 1, 200, 1) { big c; }`, Limits{MaxAllocations: 1000000}, ErrMemoryLimit},
+		{`structs { big { int x[60000]; }; } big b; big c; for (i, 1, 200, 1) { c = b; }`, Limits{MaxAllocations: 1000000}, ErrMemoryLimit},
+		{`structs { big { int x[60000]; }; } f(big p) int { f = 0; } big b; for (i, 1, 200, 1) { f(b); }`, Limits{MaxAllocations: 1000000}, ErrMemoryLimit},
+		{`global { string s = "ab"; } while (true) { s = s + s; }`, Limits{MaxAllocations: 1000}, ErrMemoryLimit},
+		{`global { int a[] = {}; } while (true) { push(a, 1); }`, Limits{MaxAllocations: 10}, ErrMemoryLimit},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
+		err = vm.Run()
+		if !errors.Is(err, tt.expected) {
+			t.Fatalf("wrong VM error for %s: want=%q, got=%v", tt.input, tt.expected, err)
+		}
+		if _, ok := err.(*RuntimeError); !ok {
+			t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+		}
+	}
+
+	// a program within its limits runs to the end
+	program := parse(`int s = 0; for (i, 1, 10, 1) { s = s + i; } s`)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	vm.SetLimits(Limits{MaxInstructions: 1000, MaxCallDepth: 1, MaxAllocations: 1})
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 55, vm.LastPoppedStackElem())
+}
+
+func TestStackOverflow(t *testing.T) {
+	// the stacks grow well beyond their initial sizes
+	runVmTests(t, []vmTestCase{{`
+		sum(int n) int {
+			sum = if (n == 0) { 0 } else { n + sum(n - 1) };
+		}
+		sum(10000);
+		`, 50005000,
+	}})
+
+	recursion := `loop(int n) int { loop = loop(n + 1); } loop(0);`
+	elements := make([]string, 200)
+	for i := range elements {
+		elements[i] = strconv.Itoa(i)
+	}
+	array := "len({" + strings.Join(elements, ", ") + "})"
+
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected string
+		cause    error
+	}{
+		{recursion, Limits{}, "stack overflow in function loop", ErrCallDepth},
+		{recursion, Limits{MaxCallDepth: 10}, "stack overflow in function loop", ErrCallDepth},
+		{recursion, Limits{MaxStackSize: 100}, "stack overflow in function loop", ErrStackOverflow},
+		{array, Limits{MaxStackSize: 100}, "stack overflow in function <main>", ErrStackOverflow},
 	}
+
 	for _, tt := range tests {
 		program := parse(tt.input)
 		comp := compiler.New()
@@ -603,7 +2068,9 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
 		}
+
 		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
 		err = vm.Run()
 		if err == nil {
 			t.Fatalf("expected VM error but resulted in none.")
@@ -611,6 +2078,105 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 		if err.Error() != tt.expected {
 			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
 		}
+		if !errors.Is(err, tt.cause) {
+			t.Fatalf("VM error %q is not caused by %q", err, tt.cause)
+		}
+	}
+}
+
+func TestStackUnderflow(t *testing.T) {
+	bytecode := &compiler.Bytecode{Instructions: code.Make(code.OpPop)}
+
+	err := New(bytecode).Run()
+	if !errors.Is(err, ErrStackUnderflow) {
+		t.Fatalf("wrong VM error: want=%q, got=%v", ErrStackUnderflow, err)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	program := parse(`while (true) { }`)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := New(comp.Bytecode()).RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong VM error: want=%q, got=%v", context.DeadlineExceeded, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	err = New(comp.Bytecode()).RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong VM error: want=%q, got=%v", context.Canceled, err)
+	}
+}
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected string
+	}{
+		{
+			`
+			divide(int a, int b) int { divide = a / b; }
+			average(int total, int n) int { average = divide(total, n); }
+			average(10, 0);
+			`,
+			Limits{},
+			"division by zero\n\tat divide\n\tat average\n\tat <main>",
+		},
+		{
+			`loop(int n) int { loop = loop(n + 1); } loop(0);`,
+			Limits{MaxCallDepth: 10},
+			"stack overflow in function loop\n\tat loop (×10)\n\tat <main>",
+		},
+		{
+			`
+			fail(int n) int { fail = 1 / n; }
+			loop(int n) int { loop = if (n == 0) { fail(n) } else { loop(n - 1) }; }
+			loop(3);
+			`,
+			Limits{},
+			"division by zero\n\tat fail\n\tat loop (×4)\n\tat <main>",
+		},
+		{
+			`
+			ping(int n) int { ping = pong(n + 1); }
+			pong(int n) int { pong = ping(n + 1); }
+			ping(0);
+			`,
+			Limits{MaxCallDepth: 1000},
+			"stack overflow in function ping" +
+				strings.Repeat("\n\tat pong\n\tat ping", 49) +
+				"\n\tat pong\n\tat ... (902 more frames)",
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
+		err = vm.Run()
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+		}
+
+		if runtimeErr.StackTrace() != tt.expected {
+			t.Fatalf("wrong stack trace: want=%q, got=%q", tt.expected, runtimeErr.StackTrace())
+		}
 	}
 }
 
@@ -619,17 +2185,8 @@ func TestBuiltInFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{
-			`len(1)`,
-			&object.Error{
-				Message: "argument to `len` not supported, got INTEGER",
-			},
-		},
-		{`len("one", "two")`,
-			&object.Error{
-				Message: "wrong number of arguments. got=2, want=1",
-			},
-		},
+		{`len({{1, 2}}, 1)`, 2},
+		{`len({{1, 2}}, 2)`, &object.Error{Message: "array has no dimension 2"}},
 		{`
 			global {
 				int v[] = {1,2,3};
@@ -647,3 +2204,62 @@ func TestBuiltInFunctions(t *testing.T) {
 	}
 	runVmTests(t, tests)
 }
+
+func TestBuiltinRegistry(t *testing.T) {
+	all := object.Builtins.All()
+	for i, b := range all {
+		if i > 0 && all[i-1].ID >= b.ID {
+			t.Fatalf("builtins not ordered by ID: %s (%d) before %s (%d)",
+				all[i-1].Name, all[i-1].ID, b.Name, b.ID)
+		}
+		if found, ok := object.Builtins.Lookup(b.Name); !ok || found != b {
+			t.Fatalf("builtin %s not found by name", b.Name)
+		}
+	}
+
+	// the IDs are part of the bytecode, they must not change
+	ids := map[string]int{"len": 0, "write": 4, "push": 10, "int": 37, "abs": 41, "is_inf": 65}
+	for name, id := range ids {
+		b, ok := object.Builtins.Get(id)
+		if !ok || b.Name != name {
+			t.Fatalf("builtin %d is not %s", id, name)
+		}
+	}
+
+	err := object.Builtins.Copy().Register(&object.Builtin{ID: 1000, Name: "len"})
+	if err == nil || err.Error() != "builtin len already registered" {
+		t.Fatalf("wrong error for a duplicate name: %v", err)
+	}
+	err = object.Builtins.Copy().Register(&object.Builtin{ID: 0, Name: "size"})
+	if err == nil || err.Error() != "builtin ID 0 of size already used by len" {
+		t.Fatalf("wrong error for a duplicate ID: %v", err)
+	}
+
+	// the arguments of values whose type is only known at run time are
+	// validated by the registry before the builtin is called
+	tests := []struct {
+		name     string
+		args     []object.Object
+		expected string
+	}{
+		{"upper", []object.Object{&object.Integer{Value: 1}},
+			"argument 1 to 'upper' must be string, got int"},
+		{"push", []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}},
+			"argument 1 to 'push' must be array, got int"},
+		{"max", []object.Object{&object.Integer{Value: 1}, &object.Boolean{Value: true}},
+			"argument 2 to 'max' must be number, got bool"},
+		{"len", []object.Object{},
+			"wrong number of arguments for 'len'. got=0, want 1 to 2"},
+		{"rand_float", []object.Object{&object.Integer{Value: 1}},
+			"wrong number of arguments for 'rand_float'. got=1, want=0"},
+	}
+
+	for _, tt := range tests {
+		b, _ := object.Builtins.Lookup(tt.name)
+		result := b.Call(object.NewRuntime(), tt.args...)
+		err, ok := result.(*object.Error)
+		if !ok || err.Message != tt.expected {
+			t.Fatalf("wrong result for %s: want=%q, got=%v", tt.name, tt.expected, result)
+		}
+	}
+}
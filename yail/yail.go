@@ -0,0 +1,233 @@
+// Package yail lets Go applications compile and run YAIL programs. Unlike the
+// command line entry points, it neither touches files nor the standard input
+// and output, and programs don't share any state: each one has its own
+// builtins, globals and runtime.
+package yail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/odas0r/yail/compiler"
+	"github.com/odas0r/yail/lexer"
+	"github.com/odas0r/yail/object"
+	"github.com/odas0r/yail/parser"
+	"github.com/odas0r/yail/vm"
+)
+
+// Option configures the compilation of a program.
+type Option func(*config) error
+
+type config struct {
+	builtins *object.Registry
+	hostIDs  int
+	globals  []global
+}
+
+type global struct {
+	name  string
+	value object.Object
+}
+
+// WithBuiltin makes a host function callable by the program, under the name
+// and with the signature of b. The ID of b is ignored, host functions are
+// numbered from object.FirstHostID.
+func WithBuiltin(b object.Builtin) Option {
+	return func(c *config) error {
+		b.ID = object.FirstHostID + c.hostIDs
+		c.hostIDs++
+		return c.builtins.Register(&b)
+	}
+}
+
+// WithFunction makes the Go function fn callable by the program under name,
+// converting its arguments and its result as object.BuiltinFromGo does.
+func WithFunction(name string, fn interface{}) Option {
+	return func(c *config) error {
+		b, err := object.BuiltinFromGo(name, fn)
+		if err != nil {
+			return err
+		}
+		return WithBuiltin(*b)(c)
+	}
+}
+
+// WithGlobal declares a global variable the program can use without declaring
+// it, holding value when the program starts.
+func WithGlobal(name string, value object.Object) Option {
+	return func(c *config) error {
+		c.globals = append(c.globals, global{name, value})
+		return nil
+	}
+}
+
+// Program is a compiled program, along with its globals which keep their
+// values from one run to the next. A Program must not be run by several
+// goroutines at once.
+type Program struct {
+	bytecode *compiler.Bytecode
+	symbols  *compiler.SymbolTable
+	builtins *object.Registry
+	globals  []object.Object
+}
+
+// Compile parses and compiles the source of a program.
+func Compile(src string, opts ...Option) (*Program, error) {
+	c := &config{builtins: object.Builtins.Copy()}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	comp := compiler.NewWithBuiltins(c.builtins)
+	globals := make([]object.Object, vm.GlobalsSize)
+	for _, g := range c.globals {
+		symbol := comp.SymbolTable().DefineWithType(g.name, staticType(g.value))
+		globals[symbol.Index] = g.value
+	}
+
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+
+	return &Program{
+		bytecode: comp.Bytecode(),
+		symbols:  comp.SymbolTable(),
+		builtins: c.builtins,
+		globals:  globals,
+	}, nil
+}
+
+// RunOptions are the options of a run. Without In, a read finds the input
+// empty, and without Out, what the program writes is discarded.
+type RunOptions struct {
+	In  io.Reader
+	Out io.Writer
+
+	// CheckedArithmetic reports integer overflows, in the operators as in the
+	// builtins, as errors instead of wrapping around.
+	CheckedArithmetic bool
+
+	// Limits bound the resources of the run, and Timeout its duration when
+	// it isn't 0, the run failing with context.DeadlineExceeded.
+	Limits  vm.Limits
+	Timeout time.Duration
+}
+
+// Run executes the program and returns the value of its last expression
+// statement, stopping it once ctx is done. A failure of the program is a
+// *vm.RuntimeError, wrapping the error of ctx or vm.ErrInstructionLimit,
+// vm.ErrCallDepth and vm.ErrMemoryLimit when it is stopped.
+func (p *Program) Run(ctx context.Context, opts RunOptions) (object.Object, error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	in, out := opts.In, opts.Out
+	if in == nil {
+		in = strings.NewReader("")
+	}
+	if out == nil {
+		out = io.Discard
+	}
+
+	machine := vm.NewWithGlobalsStore(p.bytecode, p.globals)
+	machine.UseBuiltins(p.builtins)
+	machine.SetIO(in, out)
+	machine.CheckArithmetic(opts.CheckedArithmetic)
+	machine.SetLimits(opts.Limits)
+
+	if err := machine.RunContext(ctx); err != nil {
+		return nil, err
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+// Get returns the value of the global name, as left by the last run.
+func (p *Program) Get(name string) (object.Object, error) {
+	symbol, err := p.global(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.globals[symbol.Index], nil
+}
+
+// Set changes the value of the global name for the next runs. The program
+// overwrites it if it initializes the global itself.
+func (p *Program) Set(name string, value object.Object) error {
+	symbol, err := p.global(name)
+	if err != nil {
+		return err
+	}
+
+	if !hasType(symbol.Type, value) {
+		return fmt.Errorf("cannot set %s of type %s to %s", name, symbol.Type, object.TypeName(value))
+	}
+
+	p.globals[symbol.Index] = value
+	return nil
+}
+
+func (p *Program) global(name string) (compiler.Symbol, error) {
+	symbol, ok := p.symbols.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return compiler.Symbol{}, fmt.Errorf("unknown global %s", name)
+	}
+	return symbol, nil
+}
+
+// staticType returns the type the type checker gives to value, "" when it
+// can't tell, e.g. for an empty array.
+func staticType(value object.Object) string {
+	typ := object.TypeName(value)
+	for elem := typ; ; elem = strings.TrimSuffix(elem, "[]") {
+		switch elem {
+		case "array", "map", "null", "function":
+			return ""
+		}
+		if !strings.HasSuffix(elem, "[]") {
+			return typ
+		}
+	}
+}
+
+// hasType reports whether value can be stored in a global of type typ.
+func hasType(typ string, value object.Object) bool {
+	switch {
+	case typ == "":
+		return true
+	case strings.HasSuffix(typ, "[]"):
+		arr, ok := value.(*object.Array)
+		if !ok {
+			return false
+		}
+		for _, e := range arr.Elements {
+			if !hasType(strings.TrimSuffix(typ, "[]"), e) {
+				return false
+			}
+		}
+		return true
+	case strings.HasPrefix(typ, "map["):
+		return value.Type() == object.MAP_OBJ
+	case strings.HasPrefix(typ, "func("):
+		return value.Type() == object.COMPILED_FUNCTION_OBJ || value.Type() == object.BUILTIN_OBJ
+	default:
+		return object.TypeName(value) == typ
+	}
+}
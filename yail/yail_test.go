@@ -0,0 +1,399 @@
+package yail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odas0r/yail/object"
+	"github.com/odas0r/yail/vm"
+)
+
+func TestCompileAndRun(t *testing.T) {
+	program, err := Compile(`
+	global {
+		int total;
+	}
+	add(int a, int b) int { add = a + b; }
+	total = add(limit, 2);
+	write("total", total);
+	total * 10
+	`, WithGlobal("limit", &object.Integer{Value: 40}))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	var out bytes.Buffer
+	result, err := program.Run(context.Background(), RunOptions{Out: &out})
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+
+	if result.Inspect() != "420" {
+		t.Fatalf("wrong result: want=420, got=%s", result.Inspect())
+	}
+	if out.String() != "total 42\n" {
+		t.Fatalf("wrong output: want=%q, got=%q", "total 42\n", out.String())
+	}
+
+	total, err := program.Get("total")
+	if err != nil {
+		t.Fatalf("get error: %s", err)
+	}
+	if total.Inspect() != "42" {
+		t.Fatalf("wrong total: want=42, got=%s", total.Inspect())
+	}
+
+	// the global declared by the host keeps the value it is set to
+	err = program.Set("limit", &object.Integer{Value: 1})
+	if err != nil {
+		t.Fatalf("set error: %s", err)
+	}
+	result, err = program.Run(context.Background(), RunOptions{})
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	if result.Inspect() != "30" {
+		t.Fatalf("wrong result: want=30, got=%s", result.Inspect())
+	}
+}
+
+func TestGlobalErrors(t *testing.T) {
+	program, err := Compile(`global { int n; }`)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		value    object.Object
+		expected string
+	}{
+		{"m", &object.Integer{Value: 1}, "unknown global m"},
+		{"len", &object.Integer{Value: 1}, "unknown global len"},
+		{"n", &object.String{Value: "1"}, "cannot set n of type int to string"},
+	}
+
+	for _, tt := range tests {
+		err := program.Set(tt.name, tt.value)
+		if err == nil || err.Error() != tt.expected {
+			t.Fatalf("wrong error: want=%q, got=%v", tt.expected, err)
+		}
+	}
+
+	if _, err := program.Get("m"); err == nil || err.Error() != "unknown global m" {
+		t.Fatalf("wrong error: want=%q, got=%v", "unknown global m", err)
+	}
+}
+
+func TestHostFunctions(t *testing.T) {
+	var calls []string
+	greet := object.Builtin{
+		Name:   "greet",
+		Params: []string{"string"},
+		Return: "string",
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			name := args[0].(*object.String).Value
+			calls = append(calls, name)
+			return &object.String{Value: "hello " + name}
+		},
+	}
+
+	program, err := Compile(`greet("yail")`, WithBuiltin(greet))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	result, err := program.Run(context.Background(), RunOptions{})
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	if result.Inspect() != "hello yail" {
+		t.Fatalf("wrong result: want=%q, got=%q", "hello yail", result.Inspect())
+	}
+	if len(calls) != 1 || calls[0] != "yail" {
+		t.Fatalf("wrong calls: %v", calls)
+	}
+
+	// the signature of a host function is checked like the ones of the
+	// builtins of the language
+	_, err = Compile(`greet(1)`, WithBuiltin(greet))
+	expected := "type mismatch: argument 1 of greet must be string, got int"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("wrong error: want=%q, got=%v", expected, err)
+	}
+
+	// host functions belong to the program registering them
+	_, err = Compile(`greet("yail")`)
+	if err == nil {
+		t.Fatalf("expected an error calling an unregistered host function")
+	}
+	if _, ok := object.Builtins.Lookup("greet"); ok {
+		t.Fatalf("host function leaked into the builtins of the language")
+	}
+
+	_, err = Compile(`1`, WithBuiltin(object.Builtin{Name: "len"}))
+	if err == nil || err.Error() != "builtin len already registered" {
+		t.Fatalf("wrong error: want=%q, got=%v", "builtin len already registered", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	_, err := Compile(`int = ;`)
+	if err == nil || !strings.HasPrefix(err.Error(), "parse errors:") {
+		t.Fatalf("expected a parse error, got=%v", err)
+	}
+
+	program, err := Compile(`
+	divide(int a, int b) int { divide = a / b; }
+	divide(1, 0);
+	`)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	_, err = program.Run(context.Background(), RunOptions{})
+	runtimeErr, ok := err.(*vm.RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *vm.RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.StackTrace() != "division by zero\n\tat divide\n\tat <main>" {
+		t.Fatalf("wrong stack trace: %q", runtimeErr.StackTrace())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := program.Run(ctx, RunOptions{}); err != context.Canceled {
+		t.Fatalf("wrong error: want=%v, got=%v", context.Canceled, err)
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	program, err := Compile(`while (true) { }`)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	_, err = program.Run(context.Background(), RunOptions{Timeout: 10 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error: want=%v, got=%v", context.DeadlineExceeded, err)
+	}
+
+	_, err = program.Run(context.Background(), RunOptions{Limits: vm.Limits{MaxInstructions: 100}})
+	if !errors.Is(err, vm.ErrInstructionLimit) {
+		t.Fatalf("wrong error: want=%v, got=%v", vm.ErrInstructionLimit, err)
+	}
+}
+
+func TestInput(t *testing.T) {
+	program, err := Compile(`trim(read())`)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	result, err := program.Run(context.Background(), RunOptions{In: strings.NewReader(" yail \n")})
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	if result.Inspect() != "yail" {
+		t.Fatalf("wrong result: want=%q, got=%q", "yail", result.Inspect())
+	}
+}
+
+type point struct {
+	X      int     `yail:"x"`
+	Y      float64 `yail:"y"`
+	Label  string
+	hidden int
+	Cache  []int `yail:"-"`
+}
+
+func TestGoValues(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{42, "42"},
+		{uint8(7), "7"},
+		{2.5, "2.5"},
+		{true, "true"},
+		{"yail", "yail"},
+		{[]int{1, 2, 3}, "{1, 2, 3}"},
+		{[2][]string{{"a"}, {}}, "{{a}, {}}"},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}"},
+		{map[int]bool{10: true, 2: false}, "{2: false, 10: true}"},
+		{&point{X: 1, Y: 2.5, Label: "p", hidden: 3, Cache: []int{1}}, "point { x: 1; y: 2.5; Label: p }"},
+		{&object.Integer{Value: 3}, "3"},
+	}
+
+	for _, tt := range tests {
+		obj, err := object.FromGo(tt.input)
+		if err != nil {
+			t.Fatalf("FromGo(%#v) failed: %s", tt.input, err)
+		}
+		if obj.Inspect() != tt.expected {
+			t.Fatalf("FromGo(%#v): want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	errors := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "cannot convert nil to a YAIL value"},
+		{uint64(1 << 63), "cannot convert 9223372036854775808 to int: overflow"},
+		{[]chan int{nil}, "element 0: cannot convert chan int to a YAIL value"},
+		{map[[2]int]int{{1, 2}: 3}, "unusable as map key: ARRAY"},
+	}
+
+	for _, tt := range errors {
+		_, err := object.FromGo(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Fatalf("FromGo(%#v): want error %q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	// a value converted back to Go is the one it was converted from
+	p := point{X: 1, Y: 2.5, Label: "p"}
+	obj, _ := object.FromGo(p)
+	var q point
+	if err := object.ToGo(obj, &q); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if q.X != p.X || q.Y != p.Y || q.Label != p.Label {
+		t.Fatalf("wrong point: want=%+v, got=%+v", p, q)
+	}
+
+	m := map[string][]float64{"a": {1, 2}, "b": nil}
+	obj, _ = object.FromGo(m)
+	var n map[string][]float64
+	if err := object.ToGo(obj, &n); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if len(n) != 2 || len(n["a"]) != 2 || n["a"][1] != 2 || len(n["b"]) != 0 {
+		t.Fatalf("wrong map: want=%v, got=%v", m, n)
+	}
+
+	var plain interface{}
+	obj, _ = object.FromGo([]interface{}{1, "a", []bool{true}})
+	if err := object.ToGo(obj, &plain); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if fmt.Sprint(plain) != "[1 a [true]]" {
+		t.Fatalf("wrong value: got=%v", plain)
+	}
+
+	var small int8
+	var f float64
+	var s []string
+	toGoErrors := []struct {
+		obj      object.Object
+		target   interface{}
+		expected string
+	}{
+		{&object.Integer{Value: 300}, &small, "cannot convert 300 to int8: overflow"},
+		{&object.Integer{Value: 1}, small, "target of the conversion must be a non-nil pointer, got int8"},
+		{&object.String{Value: "1"}, &f, "cannot convert string to float64"},
+		{&object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}, &s,
+			"element 0: cannot convert int to string"},
+	}
+
+	for _, tt := range toGoErrors {
+		err := object.ToGo(tt.obj, tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Fatalf("ToGo(%s): want error %q, got=%v", tt.obj.Inspect(), tt.expected, err)
+		}
+	}
+
+	// an int is accepted where a float is expected
+	if err := object.ToGo(&object.Integer{Value: 2}, &f); err != nil || f != 2 {
+		t.Fatalf("ToGo of an int to a float64: got=%v (%v)", f, err)
+	}
+}
+
+func TestGoFunctions(t *testing.T) {
+	scale := func(xs []int, k float64) []float64 {
+		result := make([]float64, len(xs))
+		for i, x := range xs {
+			result[i] = float64(x) * k
+		}
+		return result
+	}
+	sum := func(xs ...int) int {
+		total := 0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	}
+	parse := func(s string) (int, error) {
+		if s == "" {
+			return 0, fmt.Errorf("empty input")
+		}
+		return len(s), nil
+	}
+	move := func(p point, dx int) point {
+		p.X += dx
+		return p
+	}
+
+	opts := []Option{
+		WithFunction("scale", scale),
+		WithFunction("sum", sum),
+		WithFunction("parse", parse),
+		WithFunction("move", move),
+		WithGlobal("origin", mustFromGo(t, point{Label: "o"})),
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`scale({1, 2}, 2)`, "{2.0, 4.0}"},
+		{`sum()`, "0"},
+		{`sum(1, 2, 3)`, "6"},
+		{`parse("yail")`, "4"},
+		{`parse("")`, "ERROR: empty input"},
+		{`move(origin, 3).x`, "3"},
+		{`origin.x`, "0"},
+	}
+
+	for _, tt := range tests {
+		program, err := Compile(tt.input, opts...)
+		if err != nil {
+			t.Fatalf("compile error for %s: %s", tt.input, err)
+		}
+		result, err := program.Run(context.Background(), RunOptions{})
+		if err != nil {
+			t.Fatalf("run error for %s: %s", tt.input, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Fatalf("wrong result for %s: want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	// the signature of a Go function is checked by the type checker
+	_, err := Compile(`scale(1, 2)`, opts...)
+	expected := "type mismatch: argument 1 of scale must be int[], got int"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("wrong error: want=%q, got=%v", expected, err)
+	}
+
+	_, err = Compile(`1`, WithFunction("two", func() (int, int) { return 1, 2 }))
+	expected = "builtin two must return at most one value and an error"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("wrong error: want=%q, got=%v", expected, err)
+	}
+}
+
+func mustFromGo(t *testing.T, v interface{}) object.Object {
+	obj, err := object.FromGo(v)
+	if err != nil {
+		t.Fatalf("FromGo(%#v) failed: %s", v, err)
+	}
+	return obj
+}